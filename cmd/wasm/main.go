@@ -97,20 +97,154 @@ func buildDemoTree() *tree.Node {
 
 func demoGitFiles() map[string]ui.GitFileStatus {
 	return map[string]ui.GitFileStatus{
-		"cmd/server/main.go":         ui.GitModified,
-		"cmd/server/middleware.go":   ui.GitAdded,
-		"cmd/server":                ui.GitModified,
-		"cmd":                       ui.GitModified,
-		"internal/auth/jwt.go":      ui.GitModified,
-		"internal/auth/jwt_test.go": ui.GitModified,
-		"internal/auth/oauth.go":    ui.GitAdded,
-		"internal/auth":             ui.GitModified,
-		"internal/handlers/posts.go": ui.GitModified,
-		"internal/handlers":         ui.GitModified,
-		"internal":                  ui.GitModified,
-		"docs/api.md":               ui.GitAdded,
-		"docs":                      ui.GitAdded,
-		"Dockerfile":                ui.GitModified,
+		"cmd/server/main.go":         ui.GitStatus(ui.GitModified, ui.GitModified),
+		"cmd/server/middleware.go":   ui.GitStatus(ui.GitAdded, ui.GitUnchanged),
+		"internal/auth/jwt.go":       ui.GitStatus(ui.GitUnchanged, ui.GitModified),
+		"internal/auth/jwt_test.go":  ui.GitStatus(ui.GitUnchanged, ui.GitModified),
+		"internal/auth/oauth.go":     ui.GitStatus(ui.GitUnchanged, ui.GitUntracked),
+		"internal/handlers/posts.go": ui.GitStatus(ui.GitModified, ui.GitUnchanged),
+		"docs/api.md":                ui.GitStatus(ui.GitAdded, ui.GitModified),
+		"Dockerfile":                 ui.GitStatus(ui.GitUnchanged, ui.GitModified),
+	}
+}
+
+func demoFileContents() map[string]string {
+	return map[string]string{
+		"cmd/server/main.go": `package main
+
+import (
+	"log"
+	"net/http"
+
+	"my-project/internal/db"
+)
+
+func main() {
+	store, err := db.Open("postgres://localhost/app")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer store.Close()
+
+	mux := http.NewServeMux()
+	registerRoutes(mux, store)
+
+	log.Println("listening on :8080")
+	log.Fatal(http.ListenAndServe(":8080", withLogging(mux)))
+}
+`,
+		"cmd/server/middleware.go": `package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+)
+
+func withLogging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		next.ServeHTTP(w, r)
+		log.Printf("%s %s %s", r.Method, r.URL.Path, time.Since(start))
+	})
+}
+`,
+		"internal/auth/jwt.go": `package auth
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrExpired = errors.New("token expired")
+
+// Claims are the fields we sign into every session token.
+type Claims struct {
+	UserID    int64
+	ExpiresAt time.Time
+}
+
+func (c Claims) Valid() error {
+	if time.Now().After(c.ExpiresAt) {
+		return ErrExpired
+	}
+	return nil
+}
+`,
+		"go.mod": `module my-project
+
+go 1.24
+
+require github.com/jackc/pgx/v5 v5.7.1
+`,
+		"README.md": `# my-project
+
+A small API server with a React front end.
+
+## Development
+
+    make dev
+
+Runs the server on :8080 and the web app on :5173.
+`,
+		"Dockerfile": `FROM golang:1.24 AS build
+WORKDIR /src
+COPY . .
+RUN go build -o /server ./cmd/server
+
+FROM gcr.io/distroless/base
+COPY --from=build /server /server
+ENTRYPOINT ["/server"]
+`,
+	}
+}
+
+func demoFileDiffs() map[string]string {
+	return map[string]string{
+		"cmd/server/main.go": `diff --git a/cmd/server/main.go b/cmd/server/main.go
+--- a/cmd/server/main.go
++++ b/cmd/server/main.go
+@@ -15,7 +15,7 @@ func main() {
+ 	mux := http.NewServeMux()
+ 	registerRoutes(mux, store)
+ 
+-	log.Println("listening on :8080")
+-	log.Fatal(http.ListenAndServe(":8080", mux))
++	log.Println("listening on :8080")
++	log.Fatal(http.ListenAndServe(":8080", withLogging(mux)))
+ }
+`,
+		"cmd/server/middleware.go": `diff --git a/cmd/server/middleware.go b/cmd/server/middleware.go
+new file mode 100644
+--- /dev/null
++++ b/cmd/server/middleware.go
+@@ -0,0 +1,15 @@
++package main
++
++import (
++	"log"
++	"net/http"
++	"time"
++)
++
++func withLogging(next http.Handler) http.Handler {
++	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
++		start := time.Now()
++		next.ServeHTTP(w, r)
++		log.Printf("%s %s %s", r.Method, r.URL.Path, time.Since(start))
++	})
++}
+`,
+		"Dockerfile": `diff --git a/Dockerfile b/Dockerfile
+--- a/Dockerfile
++++ b/Dockerfile
+@@ -1,4 +1,4 @@
+-FROM golang:1.22 AS build
++FROM golang:1.24 AS build
+ WORKDIR /src
+ COPY . .
+ RUN go build -o /server ./cmd/server
+`,
 	}
 }
 
@@ -155,6 +289,8 @@ func main() {
 
 	m := ui.NewDemo(root, cfg)
 	m.SetGitInfo("main", demoGitFiles())
+	m.SetFileContents(demoFileContents())
+	m.SetFileDiffs(demoFileDiffs())
 	app = &m
 
 	// Expose functions to JS
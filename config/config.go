@@ -5,7 +5,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+
+	"github.com/almonk/bontree/tree"
 )
 
 // Action represents a named action that can be bound to a key.
@@ -23,15 +26,48 @@ const (
 	ActionCollapse     Action = "collapse"
 	ActionToggle       Action = "toggle"
 	ActionCopyPath     Action = "copy_path"
+	ActionCopyMenu     Action = "copy_menu"
 	ActionExpandAll    Action = "expand_all"
 	ActionCollapseAll  Action = "collapse_all"
 	ActionToggleHidden Action = "toggle_hidden"
 	ActionSearch       Action = "search"
 	ActionFlatSearch   Action = "flat_search"
+	ActionGrep         Action = "grep"
 	ActionHelp         Action = "help"
 	ActionClearFilter  Action = "clear_filter"
 	ActionOpenEditor   Action = "open_editor"
 
+	// View actions
+	ActionToggleChanged Action = "toggle_changed"
+	ActionTogglePreview Action = "toggle_preview"
+	ActionPreviewDown   Action = "preview_down"
+	ActionPreviewUp     Action = "preview_up"
+	ActionToggleDiff    Action = "toggle_diff"
+
+	// Git actions
+	ActionGitStage   Action = "git_stage"
+	ActionGitUnstage Action = "git_unstage"
+	ActionGitDiscard Action = "git_discard"
+	ActionSetBase    Action = "set_base"
+
+	// File actions
+	ActionNewFile Action = "new_file"
+	ActionNewDir  Action = "new_dir"
+	ActionRename  Action = "rename"
+	ActionMove    Action = "move"
+	ActionTrash   Action = "trash"
+	ActionYank    Action = "yank"
+	ActionCut     Action = "cut"
+	ActionPaste   Action = "paste"
+	ActionUndo    Action = "undo"
+	ActionRedo    Action = "redo"
+
+	// Mark actions
+	ActionToggleMark Action = "toggle_mark"
+	ActionMarkAll    Action = "mark_all"
+	ActionClearMarks Action = "clear_marks"
+	ActionVisualMark Action = "visual_mark"
+
 	// Search mode actions
 	ActionSearchConfirm   Action = "search_confirm"
 	ActionSearchCancel    Action = "search_cancel"
@@ -48,18 +84,152 @@ type Config struct {
 	// ShowHidden controls whether hidden files are shown by default.
 	ShowHidden bool
 
+	// RespectGitignore hides files matched by .gitignore.
+	RespectGitignore bool
+
+	// ExpandDepth is how many directory levels below the root start
+	// expanded (0 = only the root).
+	ExpandDepth int
+
+	// Exclude lists gitignore-style patterns that are always hidden. Those
+	// from a project file are relative to its directory, the rest to the
+	// opened directory.
+	Exclude []tree.Pattern
+
+	// Include lists patterns that are always shown, even when hidden,
+	// ignored or excluded.
+	Include []tree.Pattern
+
+	// Mouse enables mouse support.
+	Mouse bool
+
+	// Inline runs in the normal terminal buffer instead of the alternate
+	// screen.
+	Inline bool
+
+	// Select is a path to move the cursor to on startup. Command line only.
+	Select string
+
+	// Filter is a search query to apply on startup. Command line only.
+	Filter string
+
 	// Theme is the name of a Ghostty-compatible theme to use.
 	// Empty string means inherit from the terminal.
 	Theme string
 
+	// BaseRef is a git ref to compare the working tree against, so changes
+	// that have already been committed still show. Empty means HEAD.
+	BaseRef string
+
+	// CopySeparator joins the paths copied when several files are marked.
+	CopySeparator string
+
+	// CopyFormats are the templates offered by the copy menu, in order.
+	CopyFormats []CopyFormat
+
+	// Socket is the path of a Unix socket to accept control commands on.
+	// Empty means no socket.
+	Socket string
+
+	// Commands are the user-defined shell commands, run with "run:<name>"
+	// actions.
+	Commands []Command
+}
+
+// CopyFormat is a named template for copying a file reference, e.g.
+// "@{path}". See the README for the placeholders it may contain.
+type CopyFormat struct {
+	Name     string
+	Template string
+}
+
+// copyFormatPrefix introduces an action that copies with a named format,
+// e.g. "copy:mention".
+const copyFormatPrefix = "copy:"
+
+// CopyFormatAction returns the action that copies using the named format.
+func CopyFormatAction(name string) Action {
+	return Action(copyFormatPrefix + name)
+}
+
+// CopyFormatName returns the format name of a "copy:<name>" action.
+func (a Action) CopyFormatName() (string, bool) {
+	name, ok := strings.CutPrefix(string(a), copyFormatPrefix)
+	return name, ok && name != ""
+}
+
+// CopyFormat returns the named copy format.
+func (c *Config) CopyFormat(name string) (CopyFormat, bool) {
+	for _, f := range c.CopyFormats {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return CopyFormat{}, false
+}
+
+// CommandMode is how a command's output is shown.
+type CommandMode string
+
+const (
+	CommandPane        CommandMode = "pane"        // show the output in a scrollable pane
+	CommandFlash       CommandMode = "flash"       // flash the last line of output
+	CommandInteractive CommandMode = "interactive" // hand the terminal to the command
+)
+
+// Command is a named shell command template, e.g. "go test {dir}/...". See
+// the README for the placeholders it may contain.
+type Command struct {
+	Name string
+	Mode CommandMode
+	Run  string
+}
+
+// commandPrefix introduces an action that runs a named command, e.g.
+// "run:lint".
+const commandPrefix = "run:"
+
+// CommandAction returns the action that runs the named command.
+func CommandAction(name string) Action {
+	return Action(commandPrefix + name)
+}
+
+// CommandName returns the command name of a "run:<name>" action.
+func (a Action) CommandName() (string, bool) {
+	name, ok := strings.CutPrefix(string(a), commandPrefix)
+	return name, ok && name != ""
+}
+
+// Command returns the named command.
+func (c *Config) Command(name string) (Command, bool) {
+	for _, cmd := range c.Commands {
+		if cmd.Name == name {
+			return cmd, true
+		}
+	}
+	return Command{}, false
+}
 
+// defaultCopyFormats are available without any configuration.
+var defaultCopyFormats = []CopyFormat{
+	{Name: "path", Template: "{path}"},
+	{Name: "mention", Template: "@{path}"},
+	{Name: "absolute", Template: "{abs}"},
+	{Name: "line", Template: "{path}:{line}"},
+	{Name: "link", Template: "[{name}]({path})"},
+	{Name: "contents", Template: "{path}\n```{ext}\n{contents}\n```"},
 }
 
 // DefaultConfig returns the config with all default keybindings.
 func DefaultConfig() *Config {
 	c := &Config{
-		Keybinds:   make(map[string]Action),
-		ShowHidden: false,
+		Keybinds:         make(map[string]Action),
+		ShowHidden:       false,
+		RespectGitignore: true,
+		Exclude:          tree.Patterns("", tree.DefaultExclude...),
+		Mouse:            true,
+		CopySeparator:    "\n",
+		CopyFormats:      append([]CopyFormat(nil), defaultCopyFormats...),
 	}
 
 	// Normal mode defaults
@@ -81,14 +251,39 @@ func DefaultConfig() *Config {
 		"enter":  ActionToggle,
 		" ":      ActionToggle,
 		"c":      ActionCopyPath,
+		"Y":      ActionCopyMenu,
 		"E":      ActionExpandAll,
 		"W":      ActionCollapseAll,
 		".":      ActionToggleHidden,
 		"/":      ActionSearch,
 		"ctrl+f": ActionFlatSearch,
 		"ctrl+_": ActionFlatSearch,
+		"ctrl+g": ActionGrep,
 		"?":      ActionHelp,
 		"esc":    ActionClearFilter,
+		"p":      ActionTogglePreview,
+		"J":      ActionPreviewDown,
+		"K":      ActionPreviewUp,
+		"d":      ActionToggleDiff,
+		"a":      ActionGitStage,
+		"u":      ActionGitUnstage,
+		"X":      ActionGitDiscard,
+		"C":      ActionToggleChanged,
+		"b":      ActionSetBase,
+		"n":      ActionNewFile,
+		"N":      ActionNewDir,
+		"r":      ActionRename,
+		"R":      ActionMove,
+		"D":      ActionTrash,
+		"y":      ActionYank,
+		"x":      ActionCut,
+		"P":      ActionPaste,
+		"z":      ActionUndo,
+		"Z":      ActionRedo,
+		"m":      ActionToggleMark,
+		"M":      ActionMarkAll,
+		"U":      ActionClearMarks,
+		"v":      ActionVisualMark,
 	}
 
 	for k, v := range defaults {
@@ -125,12 +320,84 @@ func LoadFrom(path string) (*Config, error) {
 		return cfg, nil
 	}
 
+	if err := loadFile(cfg, path, nil, false); err != nil {
+		if os.IsNotExist(err) {
+			return cfg, nil
+		}
+		return nil, err
+	}
+	if err := validate(cfg, path); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// ProjectFileName is the per-project config file, found by walking up from
+// the root directory.
+const ProjectFileName = ".bontree"
+
+// FindProjectConfig returns the path of the nearest .bontree file in dir or
+// one of its parents, or "" if there is none.
+func FindProjectConfig(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		path := filepath.Join(dir, ProjectFileName)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// LoadProject layers the nearest .bontree file above dir over cfg, using the
+// same syntax as the user config: keybinds merge, exclude and include
+// patterns append (relative to the directory of the file setting them),
+// and other settings override. Settings that could run
+// commands or touch files outside the project are an error, since opening a
+// cloned repository shouldn't do either. It returns the file's path, or ""
+// if there was none.
+func LoadProject(cfg *Config, dir string) (string, error) {
+	path := FindProjectConfig(dir)
+	if path == "" {
+		return "", nil
+	}
+	if err := loadFile(cfg, path, nil, true); err != nil {
+		return "", err
+	}
+	return path, validate(cfg, path)
+}
+
+// loadFile applies the settings in the config file at path to cfg. seen
+// holds the files being loaded, to catch config-file loops. A project file,
+// and any file it includes, is checked with checkProjectSetting. A missing
+// file is reported with an error satisfying os.IsNotExist.
+func loadFile(cfg *Config, path string, seen map[string]bool, project bool) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if seen == nil {
+		seen = make(map[string]bool)
+	}
+	if seen[absPath] {
+		return fmt.Errorf("%s: config-file loop", path)
+	}
+	seen[absPath] = true
+	defer delete(seen, absPath)
+
 	f, err := os.Open(path)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return cfg, nil
+			return err
 		}
-		return nil, fmt.Errorf("opening config: %w", err)
+		return fmt.Errorf("opening config: %w", err)
 	}
 	defer f.Close()
 
@@ -148,45 +415,202 @@ func LoadFrom(path string) (*Config, error) {
 		// Parse "key = value"
 		eqIdx := strings.Index(line, "=")
 		if eqIdx < 0 {
-			return nil, fmt.Errorf("%s:%d: invalid syntax (expected key = value): %s", path, lineNum, line)
+			return fmt.Errorf("%s:%d: invalid syntax (expected key = value): %s", path, lineNum, line)
 		}
 
 		key := strings.TrimSpace(line[:eqIdx])
 		value := strings.TrimSpace(line[eqIdx+1:])
 
 		if key == "" {
-			return nil, fmt.Errorf("%s:%d: empty key", path, lineNum)
+			return fmt.Errorf("%s:%d: empty key", path, lineNum)
+		}
+		if project {
+			if err := checkProjectSetting(key, value, path, lineNum); err != nil {
+				return err
+			}
 		}
 
 		switch key {
 		case "keybind":
 			if err := parseKeybind(cfg, value, path, lineNum); err != nil {
-				return nil, err
+				return err
 			}
 
 		case "show-hidden":
-			switch value {
-			case "true":
-				cfg.ShowHidden = true
-			case "false":
-				cfg.ShowHidden = false
-			default:
-				return nil, fmt.Errorf("%s:%d: show-hidden must be true or false, got %q", path, lineNum, value)
+			if cfg.ShowHidden, err = parseBool(key, value, path, lineNum); err != nil {
+				return err
+			}
+
+		case "gitignore":
+			if cfg.RespectGitignore, err = parseBool(key, value, path, lineNum); err != nil {
+				return err
+			}
+
+		case "exclude", "include":
+			patterns, err := parsePatterns(key, value, path, lineNum)
+			if err != nil {
+				return err
+			}
+			// Like a .gitignore, a project file's patterns are relative to
+			// where it is, even when bontree opens a subdirectory
+			dir := ""
+			if project {
+				dir = filepath.Dir(absPath)
+			}
+			list := &cfg.Exclude
+			if key == "include" {
+				list = &cfg.Include
+			}
+			if patterns == nil {
+				*list = nil // an empty value clears the list, defaults included
+			} else {
+				*list = append(*list, tree.Patterns(dir, patterns...)...)
+			}
+
+		case "mouse":
+			if cfg.Mouse, err = parseBool(key, value, path, lineNum); err != nil {
+				return err
 			}
 
+		case "inline":
+			if cfg.Inline, err = parseBool(key, value, path, lineNum); err != nil {
+				return err
+			}
+
+		case "expand-depth":
+			n, convErr := strconv.Atoi(value)
+			if convErr != nil || n < 0 {
+				return fmt.Errorf("%s:%d: expand-depth must be a non-negative number, got %q", path, lineNum, value)
+			}
+			cfg.ExpandDepth = n
+
 		case "theme":
 			cfg.Theme = value
 
+		case "base":
+			if strings.HasPrefix(value, "-") {
+				return fmt.Errorf("%s:%d: base must be a git ref, got %q", path, lineNum, value)
+			}
+			cfg.BaseRef = value
+
+		case "copy-separator":
+			switch value {
+			case "newline":
+				cfg.CopySeparator = "\n"
+			case "space":
+				cfg.CopySeparator = " "
+			default:
+				return fmt.Errorf("%s:%d: copy-separator must be newline or space, got %q", path, lineNum, value)
+			}
+
+		case "socket":
+			cfg.Socket = value
+
+		case "copy-format":
+			if err := parseCopyFormat(cfg, value, path, lineNum); err != nil {
+				return err
+			}
+
+		case "command":
+			if err := parseCommand(cfg, value, path, lineNum); err != nil {
+				return err
+			}
+
+		case "config-file":
+			if err := loadInclude(cfg, value, path, lineNum, seen, project); err != nil {
+				return err
+			}
+
 		default:
-			return nil, fmt.Errorf("%s:%d: unknown config key %q", path, lineNum, key)
+			return fmt.Errorf("%s:%d: unknown config key %q", path, lineNum, key)
 		}
 	}
 
 	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("reading config: %w", err)
+		return fmt.Errorf("reading config: %w", err)
 	}
+	return nil
+}
 
-	return cfg, nil
+// loadInclude handles "config-file = path", loading another config file in
+// place. A relative path is relative to the including file's directory.
+// Files included by a project file have the same restrictions.
+func loadInclude(cfg *Config, value, path string, lineNum int, seen map[string]bool, project bool) error {
+	if value == "" {
+		return fmt.Errorf("%s:%d: config-file needs a path", path, lineNum)
+	}
+	if strings.HasPrefix(value, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			value = filepath.Join(home, value[2:])
+		}
+	}
+	if !filepath.IsAbs(value) {
+		value = filepath.Join(filepath.Dir(path), value)
+	}
+	if err := loadFile(cfg, value, seen, project); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%s:%d: config-file %s does not exist", path, lineNum, value)
+		}
+		return err
+	}
+	return nil
+}
+
+// userOnlySettings can only be set in the user config: they run commands,
+// open or remove files anywhere, or are passed to git.
+var userOnlySettings = map[string]bool{
+	"command": true,
+	"socket":  true,
+	"base":    true,
+}
+
+// checkProjectSetting rejects a setting a project file can't use: one of
+// userOnlySettings, a keybind that runs a command, or a theme given as a
+// path rather than a name.
+func checkProjectSetting(key, value, path string, lineNum int) error {
+	if userOnlySettings[key] {
+		return fmt.Errorf("%s:%d: %s can only be set in the user config", path, lineNum, key)
+	}
+	if key == "theme" && (strings.ContainsAny(value, `/\`) || value == "." || value == "..") {
+		return fmt.Errorf("%s:%d: a project's theme must be a theme name, got %q", path, lineNum, value)
+	}
+	if key == "keybind" {
+		if i := strings.LastIndex(value, "="); i >= 0 {
+			if _, ok := Action(strings.TrimSpace(value[i+1:])).CommandName(); ok {
+				return fmt.Errorf("%s:%d: keybinds that run commands can only be set in the user config", path, lineNum)
+			}
+		}
+	}
+	return nil
+}
+
+// validate checks references between settings once every file is loaded.
+func validate(cfg *Config, path string) error {
+	// Formats may be defined after the keybinds that use them
+	for key, action := range cfg.Keybinds {
+		if name, ok := action.CopyFormatName(); ok {
+			if _, ok := cfg.CopyFormat(name); !ok {
+				return fmt.Errorf("%s: keybind %q uses unknown copy format %q", path, key, name)
+			}
+		}
+		if name, ok := action.CommandName(); ok {
+			if _, ok := cfg.Command(name); !ok {
+				return fmt.Errorf("%s: keybind %q uses unknown command %q", path, key, name)
+			}
+		}
+	}
+	return nil
+}
+
+// parseBool parses a "true"/"false" setting.
+func parseBool(key, value, path string, lineNum int) (bool, error) {
+	switch value {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return false, fmt.Errorf("%s:%d: %s must be true or false, got %q", path, lineNum, key, value)
 }
 
 // parseKeybind parses a keybind value like "ctrl+c=quit" or "unbind=j".
@@ -225,14 +649,114 @@ func parseKeybind(cfg *Config, value string, path string, lineNum int) error {
 	return nil
 }
 
+// parsePatterns parses a comma-separated list of gitignore-style patterns,
+// e.g. "target/, *.pb.go". It returns nil for an empty value.
+func parsePatterns(key, value, path string, lineNum int) ([]string, error) {
+	var patterns []string
+	for _, p := range strings.Split(value, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		// Matching against "" checks the whole pattern's syntax
+		if _, err := filepath.Match(strings.ReplaceAll(p, "[!", "[^"), ""); err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid %s pattern %q", path, lineNum, key, p)
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns, nil
+}
+
+// parseCopyFormat parses a copy-format value like "mention=@{path}". A
+// format with an existing name replaces it; an empty template removes it.
+// "\n" and "\t" in the template stand for a newline and a tab.
+func parseCopyFormat(cfg *Config, value string, path string, lineNum int) error {
+	eqIdx := strings.Index(value, "=")
+	if eqIdx < 0 {
+		return fmt.Errorf("%s:%d: invalid copy-format syntax (expected name=template): %s", path, lineNum, value)
+	}
+	name := strings.TrimSpace(value[:eqIdx])
+	if name == "" {
+		return fmt.Errorf("%s:%d: empty copy-format name", path, lineNum)
+	}
+	template := strings.NewReplacer(`\n`, "\n", `\t`, "\t").Replace(strings.TrimSpace(value[eqIdx+1:]))
+
+	for i, f := range cfg.CopyFormats {
+		if f.Name == name {
+			if template == "" {
+				cfg.CopyFormats = append(cfg.CopyFormats[:i], cfg.CopyFormats[i+1:]...)
+			} else {
+				cfg.CopyFormats[i].Template = template
+			}
+			return nil
+		}
+	}
+	if template != "" {
+		cfg.CopyFormats = append(cfg.CopyFormats, CopyFormat{Name: name, Template: template})
+	}
+	return nil
+}
+
+// parseCommand parses a command value like "lint=golangci-lint run {dir}/..."
+// or "shell:interactive=$SHELL". Redefining a command replaces it, and an
+// empty command line removes it.
+func parseCommand(cfg *Config, value string, path string, lineNum int) error {
+	eqIdx := strings.Index(value, "=")
+	if eqIdx < 0 {
+		return fmt.Errorf("%s:%d: invalid command syntax (expected name=command): %s", path, lineNum, value)
+	}
+	name, modeStr, hasMode := strings.Cut(strings.TrimSpace(value[:eqIdx]), ":")
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return fmt.Errorf("%s:%d: empty command name", path, lineNum)
+	}
+	mode := CommandPane
+	if hasMode {
+		mode = CommandMode(strings.TrimSpace(modeStr))
+		switch mode {
+		case CommandPane, CommandFlash, CommandInteractive:
+		default:
+			return fmt.Errorf("%s:%d: command mode must be pane, flash or interactive, got %q", path, lineNum, modeStr)
+		}
+	}
+	run := strings.TrimSpace(value[eqIdx+1:])
+
+	for i, cmd := range cfg.Commands {
+		if cmd.Name == name {
+			if run == "" {
+				cfg.Commands = append(cfg.Commands[:i], cfg.Commands[i+1:]...)
+			} else {
+				cfg.Commands[i] = Command{Name: name, Mode: mode, Run: run}
+			}
+			return nil
+		}
+	}
+	if run != "" {
+		cfg.Commands = append(cfg.Commands, Command{Name: name, Mode: mode, Run: run})
+	}
+	return nil
+}
+
 func isValidAction(a Action) bool {
+	if _, ok := a.CopyFormatName(); ok {
+		return true
+	}
+	if _, ok := a.CommandName(); ok {
+		return true
+	}
 	switch a {
 	case ActionQuit, ActionMoveDown, ActionMoveUp, ActionGoTop, ActionGoBottom,
 		ActionHalfPageDown, ActionHalfPageUp, ActionExpand, ActionCollapse,
 		ActionToggle, ActionCopyPath, ActionExpandAll, ActionCollapseAll,
-		ActionToggleHidden, ActionSearch, ActionFlatSearch, ActionHelp,
+		ActionToggleHidden, ActionSearch, ActionFlatSearch, ActionGrep, ActionHelp,
 		ActionClearFilter, ActionOpenEditor, ActionSearchConfirm, ActionSearchCancel,
-		ActionSearchBackspace, ActionSearchNextMatch, ActionSearchPrevMatch:
+		ActionSearchBackspace, ActionSearchNextMatch, ActionSearchPrevMatch,
+		ActionTogglePreview, ActionPreviewDown, ActionPreviewUp, ActionToggleDiff,
+		ActionGitStage, ActionGitUnstage, ActionGitDiscard, ActionToggleChanged,
+		ActionSetBase, ActionToggleMark, ActionMarkAll, ActionClearMarks,
+		ActionVisualMark, ActionCopyMenu, ActionNewFile, ActionNewDir, ActionRename,
+		ActionMove, ActionTrash, ActionYank, ActionCut, ActionPaste, ActionUndo,
+		ActionRedo:
 		return true
 	}
 	return false
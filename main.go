@@ -1,45 +1,88 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/almonk/bontree/config"
 	"github.com/almonk/bontree/theme"
+	"github.com/almonk/bontree/tree"
 	"github.com/almonk/bontree/ui"
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
 )
 
 // Version is set at build time via -ldflags
 var Version = "dev"
 
+const usage = `Usage:
+  bontree [flags] [path]
+  bontree print [--json] [--depth N] [--hidden] [--no-gitignore] [--no-icons] [--base <ref>] [path]
+
+A directory named print can be opened with "bontree ./print".
+
+Flags:
+`
+
+// options holds the command line flags that don't map to config settings.
+type options struct {
+	configPath string
+	selectPath string
+	pick       bool
+	absolute   bool
+	print0     bool
+}
+
 func main() {
-	if len(os.Args) > 1 && (os.Args[1] == "-v" || os.Args[1] == "--version") {
-		fmt.Printf("bontree %s\n", Version)
-		os.Exit(0)
+	if len(os.Args) > 1 && os.Args[1] == "print" {
+		os.Exit(runPrint(os.Args[2:]))
 	}
 
-	path := "."
-	if len(os.Args) > 1 {
-		path = os.Args[1]
+	path, opts, overrides, code := parseArgs(os.Args[1:])
+	if code >= 0 {
+		os.Exit(code)
 	}
 
-	// Verify path exists
-	info, err := os.Stat(path)
+	path, err := startRoot(path, &opts.selectPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
 		os.Exit(1)
 	}
-	if !info.IsDir() {
-		fmt.Fprintf(os.Stderr, "Error: %s is not a directory\n", path)
-		os.Exit(1)
-	}
 
-	cfg, err := config.Load()
+	var cfg *config.Config
+	if opts.configPath != "" {
+		// Unlike the default location, an explicit config file must exist
+		if _, err = os.Stat(opts.configPath); err == nil {
+			cfg, err = config.LoadFrom(opts.configPath)
+		}
+	} else {
+		cfg, err = config.Load()
+	}
+	if err == nil {
+		_, err = config.LoadProject(cfg, path)
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Config error: %s\n", err)
 		os.Exit(1)
 	}
+	overrides(cfg)
+	cfg.Select = opts.selectPath
+
+	// In picker mode stdout carries the result, so the TUI runs on the
+	// terminal directly and colors are detected from it.
+	var tty *os.File
+	if opts.pick {
+		tty, err = os.OpenFile("/dev/tty", os.O_RDWR, 0)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --pick needs a terminal: %s\n", err)
+			os.Exit(1)
+		}
+		defer tty.Close()
+		lipgloss.SetDefaultRenderer(lipgloss.NewRenderer(tty))
+		ui.ApplyTheme(nil)
+	}
 
 	// Load theme if configured
 	if cfg.Theme != "" {
@@ -57,9 +100,201 @@ func main() {
 		os.Exit(1)
 	}
 
-	p := tea.NewProgram(model, tea.WithAltScreen(), tea.WithMouseAllMotion())
-	if _, err := p.Run(); err != nil {
+	var programOpts []tea.ProgramOption
+	if !cfg.Inline {
+		programOpts = append(programOpts, tea.WithAltScreen())
+	}
+	if cfg.Mouse {
+		programOpts = append(programOpts, tea.WithMouseAllMotion())
+	}
+	if opts.pick {
+		model.EnablePick()
+		programOpts = append(programOpts, tea.WithInput(tty), tea.WithOutput(tty))
+	}
+
+	p := tea.NewProgram(model, programOpts...)
+	final, err := p.Run()
+	model.Close()
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
 		os.Exit(1)
 	}
+
+	if opts.pick {
+		picked := final.(ui.Model).Picked()
+		if picked == nil {
+			os.Exit(130) // cancelled, like fzf
+		}
+		printPicked(picked, opts.absolute, opts.print0)
+	}
+}
+
+// parseArgs parses the command line; path is "" if none was given. The
+// returned overrides function applies the flags that take precedence over
+// config settings once the config is loaded. code is the exit status if
+// bontree should stop straight away (after --help, --version or a usage
+// error), or -1 to carry on.
+func parseArgs(args []string) (path string, opts options, overrides func(*config.Config), code int) {
+	fs := flag.NewFlagSet("bontree", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+
+	var version bool
+	fs.BoolVar(&version, "v", false, "print the version and exit")
+	fs.BoolVar(&version, "version", false, "print the version and exit")
+	fs.StringVar(&opts.configPath, "config", "", "read settings from `file` instead of ~/.config/bontree/config (a project's .bontree still applies)")
+	fs.StringVar(&opts.selectPath, "select", "", "start with the cursor on `path`")
+	fs.BoolVar(&opts.pick, "pick", false, "print the chosen path(s) to stdout on exit")
+	fs.BoolVar(&opts.absolute, "absolute", false, "with --pick, print absolute paths")
+	fs.BoolVar(&opts.print0, "print0", false, "with --pick, end each path with NUL instead of a newline")
+
+	themeName := fs.String("theme", "", "use the Ghostty theme `name`")
+	hidden := fs.Bool("hidden", false, "show hidden files")
+	noHidden := fs.Bool("no-hidden", false, "hide hidden files")
+	noGitignore := fs.Bool("no-gitignore", false, "show files matched by .gitignore")
+	base := fs.String("base", "", "show git changes against `ref` instead of HEAD")
+	socket := fs.String("socket", "", "accept control commands on the Unix socket at `path`")
+	filter := fs.String("filter", "", "start with the search `query` applied")
+	expandDepth := fs.Int("expand-depth", 0, "expand directories `N` levels below the root on startup")
+	noMouse := fs.Bool("no-mouse", false, "disable mouse support")
+	inline := fs.Bool("inline", false, "draw in the main screen instead of the alternate screen")
+
+	if err := parseInterspersed(fs, args, &path); err != nil {
+		if err == flag.ErrHelp {
+			return "", opts, nil, 0
+		}
+		return "", opts, nil, 2
+	}
+	if version {
+		fmt.Printf("bontree %s\n", Version)
+		return "", opts, nil, 0
+	}
+	if *hidden && *noHidden {
+		fmt.Fprintln(os.Stderr, "Error: --hidden and --no-hidden can't be combined")
+		return "", opts, nil, 2
+	}
+	if *expandDepth < 0 {
+		fmt.Fprintln(os.Stderr, "Error: --expand-depth can't be negative")
+		return "", opts, nil, 2
+	}
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if opts.selectPath != "" {
+		// --select is relative to the working directory, like the path
+		if abs, err := filepath.Abs(opts.selectPath); err == nil {
+			opts.selectPath = abs
+		}
+	}
+
+	overrides = func(cfg *config.Config) {
+		if *themeName != "" {
+			cfg.Theme = *themeName
+		}
+		if *hidden {
+			cfg.ShowHidden = true
+		}
+		if *noHidden {
+			cfg.ShowHidden = false
+		}
+		if *noGitignore {
+			cfg.RespectGitignore = false
+		}
+		if *base != "" {
+			cfg.BaseRef = *base
+		}
+		if *socket != "" {
+			cfg.Socket = *socket
+		}
+		if *filter != "" {
+			cfg.Filter = *filter
+		}
+		if set["expand-depth"] {
+			cfg.ExpandDepth = *expandDepth
+		}
+		if *noMouse {
+			cfg.Mouse = false
+		}
+		if *inline {
+			cfg.Inline = true
+		}
+	}
+	return path, opts, overrides, -1
+}
+
+// startRoot returns the directory to open, given the path from the command
+// line ("" if there was none) and the --select path. A file opens at the
+// root of its git repository (or its own directory outside one) and becomes
+// the selection; --select without a path also opens at the repository root.
+func startRoot(path string, selectPath *string) (string, error) {
+	if path == "" {
+		if *selectPath != "" {
+			if root := tree.FindRepoRoot(*selectPath); root != "" {
+				return root, nil
+			}
+		}
+		return ".", nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return path, nil
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	*selectPath = abs
+	if root := tree.FindRepoRoot(abs); root != "" {
+		return root, nil
+	}
+	return filepath.Dir(abs), nil
+}
+
+// parseInterspersed parses args with fs, allowing flags after the path as
+// well as before it, e.g. "bontree src --hidden". The positional argument
+// is stored in path; more than one is a usage error.
+func parseInterspersed(fs *flag.FlagSet, args []string, path *string) error {
+	seen := false
+	for {
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		if fs.NArg() == 0 {
+			return nil
+		}
+		if seen {
+			err := fmt.Errorf("only one path can be given, got %q and %q", *path, fs.Arg(0))
+			fmt.Fprintln(fs.Output(), err)
+			fs.Usage()
+			return err
+		}
+		*path, seen = fs.Arg(0), true
+		args = fs.Args()[1:]
+	}
+}
+
+// printPicked writes the picked paths to stdout, relative to the working
+// directory unless absolute is set, one per line or NUL-terminated.
+func printPicked(paths []string, absolute, print0 bool) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		absolute = true
+	}
+	sep := "\n"
+	if print0 {
+		sep = "\x00"
+	}
+	for _, path := range paths {
+		if !absolute {
+			if rel, err := filepath.Rel(cwd, path); err == nil {
+				path = rel
+			}
+		}
+		fmt.Print(path + sep)
+	}
 }
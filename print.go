@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/almonk/bontree/config"
+	"github.com/almonk/bontree/theme"
+	"github.com/almonk/bontree/ui"
+)
+
+// runPrint implements "bontree print": a non-interactive listing of the
+// tree, as text or JSON.
+func runPrint(args []string) int {
+	fs := flag.NewFlagSet("bontree print", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: bontree print [--json] [--depth N] [--hidden] [--no-gitignore] [--no-icons] [--base <ref>] [path]")
+		fs.PrintDefaults()
+	}
+	asJSON := fs.Bool("json", false, "print a JSON array of nodes instead of a tree")
+	depth := fs.Int("depth", 0, "descend at most `N` levels below the root (0 = unlimited)")
+	hidden := fs.Bool("hidden", false, "include hidden files")
+	noGitignore := fs.Bool("no-gitignore", false, "include files matched by .gitignore")
+	noIcons := fs.Bool("no-icons", false, "omit Nerd Font icons")
+	base := fs.String("base", "", "compare git status against `ref` instead of HEAD")
+
+	path := "."
+	if err := parseInterspersed(fs, args, &path); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return 1
+	}
+	if !info.IsDir() {
+		fmt.Fprintf(os.Stderr, "Error: %s is not a directory\n", path)
+		return 1
+	}
+
+	cfg, err := config.Load()
+	if err == nil {
+		_, err = config.LoadProject(cfg, path)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Config error: %s\n", err)
+		return 1
+	}
+	if *hidden {
+		cfg.ShowHidden = true
+	}
+	if *noGitignore {
+		cfg.RespectGitignore = false
+	}
+	if *base != "" {
+		cfg.BaseRef = *base
+	}
+	if cfg.Theme != "" {
+		t, err := theme.Load(cfg.Theme)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Theme error: %s\n", err)
+			return 1
+		}
+		ui.ApplyTheme(t)
+	}
+
+	opts := ui.PrintOptions{JSON: *asJSON, Depth: *depth, Icons: !*noIcons}
+	if err := ui.Print(os.Stdout, path, cfg, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return 1
+	}
+	return 0
+}
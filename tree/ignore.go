@@ -0,0 +1,397 @@
+package tree
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Ignore files read in every directory, in increasing order of precedence.
+// .ignore and .bontreeignore use gitignore syntax but also apply outside git
+// repositories and aren't seen by git, so they can hide files from bontree
+// alone.
+var ignoreFileNames = []string{".gitignore", ".ignore", ".bontreeignore"}
+
+// ignoreRule is one pattern line from an ignore file.
+type ignoreRule struct {
+	base     string   // absolute directory the pattern is relative to
+	segments []string // pattern split on "/"
+	anchored bool     // contains a slash, so matched from base rather than by name
+	dirOnly  bool     // trailing slash: only matches directories
+	negate   bool     // leading "!": re-includes a previously ignored path
+}
+
+// ignoreSource is an ignore file as it was when last read, so changes can be
+// detected with a stat.
+type ignoreSource struct {
+	path    string
+	exists  bool
+	modTime time.Time
+	size    int64
+}
+
+func statIgnoreSource(path string) ignoreSource {
+	src := ignoreSource{path: path}
+	if info, err := os.Stat(path); err == nil && !info.IsDir() {
+		src.exists = true
+		src.modTime = info.ModTime()
+		src.size = info.Size()
+	}
+	return src
+}
+
+// ignoreSet is the rules read from a group of files: the ignore files of one
+// directory, or a repository's global and info/exclude files.
+type ignoreSet struct {
+	sources []ignoreSource
+	rules   []ignoreRule
+}
+
+func loadIgnoreSet(base string, paths []string) *ignoreSet {
+	set := &ignoreSet{}
+	for _, p := range paths {
+		src := statIgnoreSource(p)
+		set.sources = append(set.sources, src)
+		if src.exists {
+			set.rules = append(set.rules, parseIgnoreFile(p, base)...)
+		}
+	}
+	return set
+}
+
+// stale reports whether any of the set's files changed since it was read.
+func (s *ignoreSet) stale() bool {
+	for _, src := range s.sources {
+		if statIgnoreSource(src.path) != src {
+			return true
+		}
+	}
+	return false
+}
+
+// RefreshIgnored forgets ignore files that changed on disk since they were
+// read, so directories loaded from now on use the new rules. It reports
+// whether anything changed, in which case loaded directories should be
+// reloaded.
+func (t *Tree) RefreshIgnored() bool {
+	if t == nil {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	changed := false
+	for dir, set := range t.dirs {
+		if set.stale() {
+			delete(t.dirs, dir)
+			changed = true
+		}
+	}
+	if t.repo != nil && t.repo.stale() {
+		t.repo = nil
+		changed = true
+	}
+	return changed
+}
+
+// isIgnored reports whether the entry name in dir is matched by an ignore
+// file. Ignore files are read from the enclosing git repository's root
+// down, or from the tree's root outside a repository.
+func (t *Tree) isIgnored(dir, name string, isDir bool) bool {
+	if t == nil {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Later rules take precedence, so check them from the end
+	abs := filepath.Join(dir, name)
+	sets := t.ignoreSetsFor(dir)
+	for i := len(sets) - 1; i >= 0; i-- {
+		rules := sets[i].rules
+		for j := len(rules) - 1; j >= 0; j-- {
+			if rules[j].match(abs, isDir) {
+				return !rules[j].negate
+			}
+		}
+	}
+	return false
+}
+
+// ignoreSetsFor returns the rule sets that apply to entries of dir, from
+// lowest to highest precedence. The caller holds t.mu.
+func (t *Tree) ignoreSetsFor(dir string) []*ignoreSet {
+	if t.repo == nil {
+		var paths []string
+		if gitDir := filepath.Join(t.top, ".git"); exists(gitDir) {
+			paths = repoIgnoreFiles(gitDir)
+		}
+		t.repo = loadIgnoreSet(t.top, paths)
+	}
+	sets := []*ignoreSet{t.repo}
+
+	// Directories from top down to dir
+	var chain []string
+	for d := dir; ; d = filepath.Dir(d) {
+		chain = append(chain, d)
+		if d == t.top || filepath.Dir(d) == d {
+			break
+		}
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		d := chain[i]
+		set, ok := t.dirs[d]
+		if !ok {
+			paths := make([]string, len(ignoreFileNames))
+			for j, name := range ignoreFileNames {
+				paths[j] = filepath.Join(d, name)
+			}
+			set = loadIgnoreSet(d, paths)
+			t.dirs[d] = set
+		}
+		sets = append(sets, set)
+	}
+	return sets
+}
+
+// repoIgnoreFiles returns the repository-wide exclude files in increasing
+// order of precedence: the global excludes file, then info/exclude.
+func repoIgnoreFiles(gitDir string) []string {
+	var paths []string
+	if global := globalExcludesFile(); global != "" {
+		paths = append(paths, global)
+	}
+	// In worktrees and submodules .git is a file pointing at the real
+	// directory, which isn't followed, so only a plain .git directory
+	// contributes info/exclude.
+	return append(paths, filepath.Join(gitDir, "info", "exclude"))
+}
+
+// globalExcludesFile returns git's core.excludesFile, defaulting to
+// $XDG_CONFIG_HOME/git/ignore as git does.
+func globalExcludesFile() string {
+	home, _ := os.UserHomeDir()
+	xdg := os.Getenv("XDG_CONFIG_HOME")
+	if xdg == "" && home != "" {
+		xdg = filepath.Join(home, ".config")
+	}
+
+	var configs []string
+	if xdg != "" {
+		configs = append(configs, filepath.Join(xdg, "git", "config"))
+	}
+	if home != "" {
+		configs = append(configs, filepath.Join(home, ".gitconfig"))
+	}
+	// ~/.gitconfig is read last by git, so it wins
+	file := ""
+	for _, cfg := range configs {
+		if f := readExcludesFile(cfg); f != "" {
+			file = f
+		}
+	}
+	if file == "" && xdg != "" {
+		return filepath.Join(xdg, "git", "ignore")
+	}
+	if strings.HasPrefix(file, "~/") && home != "" {
+		file = filepath.Join(home, file[2:])
+	}
+	return file
+}
+
+// readExcludesFile returns the core.excludesFile setting from a git config
+// file, or "". Only the plain "key = value" form is understood.
+func readExcludesFile(configPath string) string {
+	f, err := os.Open(configPath)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	value := ""
+	inCore := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			inCore = strings.EqualFold(strings.Trim(line, "[] \t"), "core")
+			continue
+		}
+		key, v, ok := strings.Cut(line, "=")
+		if inCore && ok && strings.EqualFold(strings.TrimSpace(key), "excludesfile") {
+			value = strings.Trim(strings.TrimSpace(v), `"`)
+		}
+	}
+	return value
+}
+
+// parseIgnoreFile reads the rules from a gitignore-syntax file whose
+// patterns are relative to base.
+func parseIgnoreFile(filePath, base string) []ignoreRule {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if rule, ok := parseIgnoreLine(scanner.Text(), base); ok {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// parseIgnoreLine parses one line of a gitignore file. ok is false for blank
+// lines and comments.
+func parseIgnoreLine(line, base string) (rule ignoreRule, ok bool) {
+	line = strings.TrimSuffix(line, "\r")
+	// Trailing spaces are dropped unless escaped with a backslash
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	if line == "" || line[0] == '#' {
+		return rule, false
+	}
+
+	rule.base = base
+	if line[0] == '!' {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return rule, false
+	}
+
+	// A slash anywhere but the end anchors the pattern to base
+	if strings.Contains(line, "/") {
+		rule.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	// path.Match spells negated character classes [^...], git [!...]
+	line = strings.ReplaceAll(line, "[!", "[^")
+	rule.segments = strings.Split(line, "/")
+	return rule, true
+}
+
+// parsePatterns parses patterns relative to their directories, or to root
+// for those without one.
+func parsePatterns(patterns []Pattern, root string) []ignoreRule {
+	var rules []ignoreRule
+	for _, p := range patterns {
+		base := p.Dir
+		if base == "" {
+			base = root
+		}
+		if rule, ok := parseIgnoreLine(p.Pattern, base); ok {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// matchRules reports whether abs is matched by rules, the last matching
+// rule deciding as in an ignore file.
+func matchRules(rules []ignoreRule, abs string, isDir bool) bool {
+	for i := len(rules) - 1; i >= 0; i-- {
+		if rules[i].match(abs, isDir) {
+			return !rules[i].negate
+		}
+	}
+	return false
+}
+
+// leadsToMatch reports whether the directory abs could contain a path
+// matched by one of rules, so an include pattern like ".github/workflows/*"
+// also shows the directories leading to it. A pattern starting with "**"
+// could match below any directory, so it doesn't show them.
+func leadsToMatch(rules []ignoreRule, abs string) bool {
+	for _, r := range rules {
+		if !r.anchored || r.negate || r.segments[0] == "**" {
+			continue
+		}
+		rel, ok := strings.CutPrefix(abs, r.base+string(filepath.Separator))
+		if ok && matchPrefix(r.segments, strings.Split(filepath.ToSlash(rel), "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPrefix reports whether segments match the start of pattern, with
+// more of the pattern left over.
+func matchPrefix(pattern, segments []string) bool {
+	for ; len(segments) > 0; pattern, segments = pattern[1:], segments[1:] {
+		if len(pattern) == 0 {
+			return false
+		}
+		if pattern[0] == "**" {
+			return true
+		}
+		if !matchSegment(pattern[0], segments[0]) {
+			return false
+		}
+	}
+	return len(pattern) > 0
+}
+
+// match reports whether the rule matches the path abs.
+func (r ignoreRule) match(abs string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	rel, ok := strings.CutPrefix(abs, r.base+string(filepath.Separator))
+	if !ok {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	if !r.anchored {
+		return matchSegment(r.segments[0], path.Base(rel))
+	}
+	return matchSegments(r.segments, strings.Split(rel, "/"))
+}
+
+// matchSegments matches path segments against pattern segments, where "**"
+// matches any number of directories.
+func matchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			rest := pattern[1:]
+			if len(rest) == 0 {
+				// A trailing "/**" matches everything inside, not the directory itself
+				return len(segments) > 0
+			}
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(rest, segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 || !matchSegment(pattern[0], segments[0]) {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
+
+func matchSegment(pattern, name string) bool {
+	ok, err := path.Match(pattern, name)
+	return ok && err == nil
+}
+
+func exists(p string) bool {
+	_, err := os.Lstat(p)
+	return err == nil
+}
@@ -0,0 +1,226 @@
+package tree
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIgnoreRuleMatch(t *testing.T) {
+	base := filepath.FromSlash("/repo")
+	tests := []struct {
+		pattern string
+		path    string
+		isDir   bool
+		want    bool
+	}{
+		{"*.log", "debug.log", false, true},
+		{"*.log", "a/b/debug.log", false, true},
+		{"*.log", "debug.txt", false, false},
+		{"build/", "build", true, true},
+		{"build/", "build", false, false},
+		{"build/", "src/build", true, true},
+		{"/build", "build", true, true},
+		{"/build", "src/build", true, false},
+		{"docs/*.md", "docs/a.md", false, true},
+		{"docs/*.md", "docs/sub/a.md", false, false},
+		{"docs/*.md", "x/docs/a.md", false, false},
+		{"**/cache", "cache", true, true},
+		{"**/cache", "a/b/cache", true, true},
+		{"a/**/z", "a/z", false, true},
+		{"a/**/z", "a/b/c/z", false, true},
+		{"a/**", "a/b", false, true},
+		{"a/**", "a", true, false},
+		{"file[0-9].txt", "file3.txt", false, true},
+		{"file[!0-9].txt", "file3.txt", false, false},
+		{"file[!0-9].txt", "fileX.txt", false, true},
+		{`\#notes`, "#notes", false, true},
+		{"trailing   ", "trailing", false, true},
+	}
+	for _, tt := range tests {
+		rule, ok := parseIgnoreLine(tt.pattern, base)
+		if !ok {
+			t.Errorf("%q: not parsed as a rule", tt.pattern)
+			continue
+		}
+		got := rule.match(filepath.Join(base, filepath.FromSlash(tt.path)), tt.isDir)
+		if got != tt.want {
+			t.Errorf("%q matching %q (dir=%v) = %v, want %v", tt.pattern, tt.path, tt.isDir, got, tt.want)
+		}
+	}
+
+	for _, line := range []string{"", "# comment", "   ", "/"} {
+		if _, ok := parseIgnoreLine(line, base); ok {
+			t.Errorf("%q should not be a rule", line)
+		}
+	}
+}
+
+func TestBuildTreeIgnoreFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		".gitignore":          "*.log\n/out/\n!keep.log\n",
+		"sub/.gitignore":      "local.txt\n",
+		"sub/.bontreeignore":  "secret.txt\n",
+		".ignore":             "vendor/\n",
+		"a.log":               "",
+		"keep.log":            "",
+		"main.go":             "",
+		"out/bin":             "",
+		"vendor/lib.go":       "",
+		"sub/local.txt":       "",
+		"sub/secret.txt":      "",
+		"sub/other.txt":       "",
+		"sub/deeper/x.log":    "",
+		"sub/deeper/local.go": "",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tr, err := New(dir, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := tr.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	visible := make(map[string]bool)
+	for _, node := range FlattenAll(root) {
+		visible[filepath.ToSlash(node.Path)] = true
+	}
+	for _, path := range []string{"keep.log", "main.go", "sub/other.txt", "sub/deeper/local.go"} {
+		if !visible[path] {
+			t.Errorf("%s should be visible", path)
+		}
+	}
+	for _, path := range []string{"a.log", "out", "vendor", "sub/local.txt", "sub/secret.txt", "sub/deeper/x.log"} {
+		if visible[path] {
+			t.Errorf("%s should be ignored", path)
+		}
+	}
+
+	// Editing an ignore file is picked up after a refresh and reload
+	if err := os.WriteFile(filepath.Join(dir, "sub", ".gitignore"), []byte("other.txt\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if !tr.RefreshIgnored() {
+		t.Fatal("RefreshIgnored should report the change")
+	}
+	sub := root.Find("sub")
+	if err := sub.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if sub.Find("local.txt") == nil || sub.Find("other.txt") != nil {
+		t.Error("sub should be filtered by the edited .gitignore")
+	}
+	if tr.RefreshIgnored() {
+		t.Error("RefreshIgnored should report no change the second time")
+	}
+}
+
+func TestExcludeInclude(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		".git/HEAD", ".env", ".env.example", ".github/workflows/ci.yml",
+		".github/.secret", "target/out", "api/a.pb.go", "api/a.go",
+		"node_modules/x/index.js",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tr, err := New(dir, Options{
+		Exclude: Patterns("", ".git", "node_modules", "target/", "*.pb.go"),
+		Include: Patterns("", ".env.example", ".github/workflows/*.yml"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := tr.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	visible := make(map[string]bool)
+	for _, node := range FlattenAll(root) {
+		visible[filepath.ToSlash(node.Path)] = true
+	}
+	for _, path := range []string{".env.example", ".github", ".github/workflows/ci.yml", "api/a.go"} {
+		if !visible[path] {
+			t.Errorf("%s should be visible", path)
+		}
+	}
+	for _, path := range []string{".git", ".env", ".github/.secret", "target", "api/a.pb.go", "node_modules"} {
+		if visible[path] {
+			t.Errorf("%s should be hidden", path)
+		}
+	}
+
+	// Walk visits the same files, in the same order, without loading nodes
+	var want, walked []string
+	for _, node := range FlattenAll(root) {
+		if !node.IsDir {
+			want = append(want, node.Path)
+		}
+	}
+	if err := tr.Walk(func(path string) error {
+		walked = append(walked, path)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(walked, ",") != strings.Join(want, ",") {
+		t.Errorf("Walk = %v, want %v", walked, want)
+	}
+
+	// A pattern starting with ** doesn't show every directory on the way,
+	// and a default exclude can be included back
+	tr, err = New(dir, Options{Exclude: Patterns("", DefaultExclude...), Include: Patterns("", "**/.env.example", "node_modules/")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root, err = tr.Build(); err != nil {
+		t.Fatal(err)
+	}
+	visible = make(map[string]bool)
+	for _, node := range FlattenAll(root) {
+		visible[filepath.ToSlash(node.Path)] = true
+	}
+	for _, path := range []string{".env.example", "node_modules/x/index.js"} {
+		if !visible[path] {
+			t.Errorf("%s should be visible", path)
+		}
+	}
+	for _, path := range []string{".git", ".github"} {
+		if visible[path] {
+			t.Errorf("%s should be hidden", path)
+		}
+	}
+	// Patterns with a directory are relative to it, not to the root, as
+	// for a .bontree above the opened directory
+	tr, err = New(filepath.Join(dir, "api"), Options{Exclude: Patterns(dir, "/api/*.pb.go", "/a.go")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root, err = tr.Build(); err != nil {
+		t.Fatal(err)
+	}
+	if root.Find("a.pb.go") != nil || root.Find("a.go") == nil {
+		t.Error("api/a.pb.go should be hidden and api/a.go shown")
+	}
+}
@@ -2,7 +2,6 @@ package tree
 
 import (
 	"os"
-	"os/exec"
 	"path/filepath"
 	"sort"
 	"strings"
@@ -19,81 +18,28 @@ type Node struct {
 	Expanded bool
 	Depth    int
 	Loaded   bool // whether children have been loaded
-}
-
-// Always hidden — never shown regardless of ShowHidden
-var alwaysHidden = map[string]bool{
-	".git": true,
-}
 
-// Non-dot dirs to skip unless ShowHidden is on
-var defaultHidden = map[string]bool{
-	"node_modules": true,
-	"__pycache__":  true,
+	tree *Tree // settings for loading children; nil shows every entry, hidden and ignored ones included
 }
 
-// ShowHidden controls whether hidden/ignored files are displayed
-var ShowHidden = true
-
-// RespectGitignore controls whether .gitignored files are hidden
-var RespectGitignore = true
-
-// cachedIgnored is the set of gitignored paths (relative to repo root)
-var cachedIgnored map[string]bool
-
-// RefreshGitIgnored rebuilds the gitignore cache for the given root path.
-func RefreshGitIgnored(rootPath string) {
-	absRoot, err := filepath.Abs(rootPath)
+// FindRepoRoot returns the absolute path of the git work tree containing
+// path, or "" if path isn't inside one.
+func FindRepoRoot(path string) string {
+	dir, err := filepath.Abs(path)
 	if err != nil {
-		cachedIgnored = nil
-		return
+		return ""
 	}
-	cmd := exec.Command("git", "-C", absRoot, "ls-files", "--others", "--ignored", "--exclude-standard", "--directory")
-	out, err := cmd.Output()
-	if err != nil {
-		cachedIgnored = nil
-		return
-	}
-	ignored := make(map[string]bool)
-	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
-		line = strings.TrimSuffix(strings.TrimSpace(line), "/")
-		if line != "" {
-			ignored[line] = true
+	for {
+		// .git is a directory, or a file in worktrees and submodules
+		if _, err := os.Lstat(filepath.Join(dir, ".git")); err == nil {
+			return dir
 		}
-	}
-	cachedIgnored = ignored
-}
-
-// BuildTree creates a tree from a root path (only loads top level initially)
-func BuildTree(rootPath string) (*Node, error) {
-	absPath, err := filepath.Abs(rootPath)
-	if err != nil {
-		return nil, err
-	}
-
-	info, err := os.Stat(absPath)
-	if err != nil {
-		return nil, err
-	}
-
-	root := &Node{
-		Name:     info.Name(),
-		Path:     ".",
-		AbsPath:  absPath,
-		IsDir:    info.IsDir(),
-		Expanded: true,
-		Depth:    0,
-		Loaded:   false,
-	}
-
-	if root.IsDir {
-		err = loadChildren(root)
-		if err != nil {
-			return nil, err
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
 		}
+		dir = parent
 	}
-
-	return root, nil
 }
 
 // loadChildren loads the immediate children of a directory node
@@ -103,31 +49,18 @@ func loadChildren(node *Node) error {
 		return err
 	}
 
+	opts, exclude, include := node.tree.filter()
 	node.Children = nil
 	var dirs []*Node
 	var files []*Node
 
 	for _, entry := range entries {
-		name := entry.Name()
-
-		if alwaysHidden[name] {
-			continue
-		}
-
-		// Skip dot files and default hidden dirs unless ShowHidden is on
-		if !ShowHidden && (strings.HasPrefix(name, ".") || defaultHidden[name]) {
+		if !node.tree.shows(node.AbsPath, entry, opts, exclude, include) {
 			continue
 		}
-
-		// Skip gitignored files
-		relPath := filepath.Join(node.Path, name)
-		relPath = strings.TrimPrefix(relPath, "./")
-		if RespectGitignore && cachedIgnored != nil && cachedIgnored[relPath] {
-			continue
-		}
-
-		childPath := filepath.Join(node.Path, name)
+		name := entry.Name()
 		childAbsPath := filepath.Join(node.AbsPath, name)
+		childPath := filepath.Join(node.Path, name)
 
 		child := &Node{
 			Name:    name,
@@ -137,6 +70,7 @@ func loadChildren(node *Node) error {
 			Parent:  node,
 			Depth:   node.Depth + 1,
 			Loaded:  false,
+			tree:    node.tree,
 		}
 
 		if entry.IsDir() {
@@ -156,9 +90,180 @@ func loadChildren(node *Node) error {
 
 	node.Children = append(dirs, files...)
 	node.Loaded = true
+	node.tree.countLoad()
 	return nil
 }
 
+// shows reports whether the entry in dir passes the filter from t.filter.
+func (t *Tree) shows(dir string, entry os.DirEntry, opts Options, exclude, include []ignoreRule) bool {
+	name := entry.Name()
+	abs := filepath.Join(dir, name)
+
+	// Include patterns win over everything below
+	if matchRules(include, abs, entry.IsDir()) || (entry.IsDir() && leadsToMatch(include, abs)) {
+		return true
+	}
+	if matchRules(exclude, abs, entry.IsDir()) {
+		return false
+	}
+
+	// Skip dot files and default hidden dirs unless ShowHidden is on
+	if !opts.ShowHidden && strings.HasPrefix(name, ".") {
+		return false
+	}
+
+	// Skip gitignored files
+	return !opts.RespectGitignore || !t.isIgnored(dir, name, entry.IsDir())
+}
+
+// Reload re-reads the children of a loaded directory from disk. Children that
+// still exist keep their node (and with it their expanded/loaded subtree), so
+// only entries that were actually added or removed change.
+func (n *Node) Reload() error {
+	if !n.IsDir || !n.Loaded {
+		return nil
+	}
+	existing := make(map[string]*Node, len(n.Children))
+	for _, child := range n.Children {
+		existing[child.Name] = child
+	}
+	if err := loadChildren(n); err != nil {
+		return err
+	}
+	for i, child := range n.Children {
+		if old, ok := existing[child.Name]; ok && old.IsDir == child.IsDir {
+			n.Children[i] = old
+		}
+	}
+	return nil
+}
+
+// Find returns the already-loaded node at the given relative path, or nil.
+// It never touches the filesystem.
+func (n *Node) Find(relPath string) *Node {
+	relPath = strings.TrimPrefix(filepath.ToSlash(filepath.Clean(relPath)), "./")
+	if relPath == "." || relPath == "" {
+		return n
+	}
+	current := n
+	for _, part := range strings.Split(relPath, "/") {
+		var next *Node
+		for _, child := range current.Children {
+			if child.Name == part {
+				next = child
+				break
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		current = next
+	}
+	return current
+}
+
+// Resolve returns the node at the given relative path, loading directories
+// along the way as needed (without expanding them). It returns nil if the
+// path doesn't exist or is filtered out.
+func (n *Node) Resolve(relPath string) *Node {
+	relPath = strings.TrimPrefix(filepath.ToSlash(filepath.Clean(relPath)), "./")
+	if relPath == "." || relPath == "" {
+		return n
+	}
+	current := n
+	for _, part := range strings.Split(relPath, "/") {
+		if !current.IsDir {
+			return nil
+		}
+		if !current.Loaded {
+			if err := loadChildren(current); err != nil {
+				return nil
+			}
+		}
+		var next *Node
+		for _, child := range current.Children {
+			if child.Name == part {
+				next = child
+				break
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		current = next
+	}
+	return current
+}
+
+// Remove detaches n from its parent after it was deleted on disk. It never
+// touches the filesystem.
+func (n *Node) Remove() {
+	if n.Parent == nil {
+		return
+	}
+	siblings := n.Parent.Children
+	for i, child := range siblings {
+		if child == n {
+			n.Parent.Children = append(siblings[:i:i], siblings[i+1:]...)
+			break
+		}
+	}
+	n.Parent = nil
+	if n.IsDir {
+		n.tree.countLoad()
+	}
+}
+
+// Move re-attaches n to parent as name after it was renamed or moved on
+// disk, so its loaded subtree and expanded state survive. It never touches
+// the filesystem. If parent's children aren't loaded yet, n is only
+// detached; it will be read along with them.
+func (n *Node) Move(parent *Node, name string) {
+	n.Remove()
+	n.Name = name
+	n.relocate(parent)
+	if !parent.Loaded {
+		return
+	}
+	n.Parent = parent
+	i := sort.Search(len(parent.Children), func(i int) bool {
+		return childLess(n, parent.Children[i])
+	})
+	parent.Children = append(parent.Children[:i], append([]*Node{n}, parent.Children[i:]...)...)
+}
+
+// relocate updates the paths and depths of n and its loaded subtree for a
+// new parent.
+func (n *Node) relocate(parent *Node) {
+	n.Path = filepath.Join(parent.Path, n.Name)
+	n.AbsPath = filepath.Join(parent.AbsPath, n.Name)
+	n.Depth = parent.Depth + 1
+	for _, child := range n.Children {
+		child.relocate(n)
+	}
+}
+
+// childLess orders directory entries as loadChildren does: directories
+// first, then case-insensitively by name.
+func childLess(a, b *Node) bool {
+	if a.IsDir != b.IsDir {
+		return a.IsDir
+	}
+	return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+}
+
+// Unload collapses n and drops its children, so they are read from disk
+// again the next time it expands.
+func (n *Node) Unload() {
+	if !n.IsDir || !n.Loaded {
+		return
+	}
+	n.Children = nil
+	n.Loaded = false
+	n.Expanded = false
+	n.tree.countLoad()
+}
+
 // Toggle expands or collapses a directory node
 func (n *Node) Toggle() error {
 	if !n.IsDir {
@@ -234,6 +339,24 @@ func flattenAll(node *Node, result *[]*Node) {
 	}
 }
 
+// LoadedDirs returns every directory node whose children have been read
+// from disk, starting with root. Unlike FlattenAll it never loads anything.
+func LoadedDirs(root *Node) []*Node {
+	var result []*Node
+	var walk func(*Node)
+	walk = func(node *Node) {
+		if !node.IsDir || !node.Loaded {
+			return
+		}
+		result = append(result, node)
+		for _, child := range node.Children {
+			walk(child)
+		}
+	}
+	walk(root)
+	return result
+}
+
 // IsLastChild returns whether this node is the last child of its parent
 func (n *Node) IsLastChild() bool {
 	if n.Parent == nil {
@@ -0,0 +1,97 @@
+package tree
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNodeMove(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a/sub/x.go", "b/y.go", "b/z.go"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	root, err := BuildTree(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := root.Resolve("a/sub")
+	sub.Expand()
+	b := root.Resolve("b")
+	b.Expand()
+
+	// Move a/sub to b/sub, as if renamed on disk
+	sub.Move(b, "sub")
+	if root.Find("a/sub") != nil {
+		t.Error("a/sub should be gone from a")
+	}
+	if got := root.Find("b/sub"); got != sub {
+		t.Fatal("b/sub should be the moved node")
+	}
+	if !sub.Expanded || sub.Depth != 2 || sub.Parent != b {
+		t.Errorf("moved node: expanded=%v depth=%d", sub.Expanded, sub.Depth)
+	}
+	x := root.Find("b/sub/x.go")
+	if x == nil || x.Path != filepath.Join("b", "sub", "x.go") || x.AbsPath != filepath.Join(dir, "b", "sub", "x.go") || x.Depth != 3 {
+		t.Errorf("child not relocated: %+v", x)
+	}
+	// Directories sort before files
+	if b.Children[0] != sub {
+		t.Errorf("b's first child = %s, want sub", b.Children[0].Name)
+	}
+
+	// Renaming in place keeps the order sorted
+	y := root.Find("b/y.go")
+	y.Move(b, "a.go")
+	var names []string
+	for _, child := range b.Children {
+		names = append(names, child.Name)
+	}
+	if want := []string{"sub", "a.go", "z.go"}; len(names) != 3 || names[0] != want[0] || names[1] != want[1] || names[2] != want[2] {
+		t.Errorf("children = %v, want %v", names, want)
+	}
+
+	y.Remove()
+	if root.Find("b/a.go") != nil || y.Parent != nil {
+		t.Error("removed node should be detached")
+	}
+}
+
+func TestLoads(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "a", "b"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	tr, err := New(dir, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := tr.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loads := tr.Loads()
+	root.Find("a").Collapse()
+	if tr.Loads() != loads {
+		t.Error("collapsing shouldn't count as a load")
+	}
+
+	a := root.Resolve("a/b").Parent
+	if tr.Loads() == loads {
+		t.Error("Resolve loaded a without counting it")
+	}
+	loads = tr.Loads()
+	a.Unload()
+	if tr.Loads() == loads || a.Loaded || a.Children != nil {
+		t.Error("Unload should drop a's children and count it")
+	}
+	if len(LoadedDirs(root)) != 1 {
+		t.Errorf("LoadedDirs = %d dirs, want only the root", len(LoadedDirs(root)))
+	}
+}
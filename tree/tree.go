@@ -0,0 +1,229 @@
+package tree
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Options controls which directory entries a Tree shows.
+type Options struct {
+	// ShowHidden shows dotfiles.
+	ShowHidden bool
+
+	// RespectGitignore hides files matched by .gitignore (and
+	// .ignore/.bontreeignore) files.
+	RespectGitignore bool
+
+	// Exclude hides entries matching any of these patterns, e.g. "target/"
+	// or "*.pb.go".
+	Exclude []Pattern
+
+	// Include always shows entries matching these patterns, even when they
+	// are hidden, ignored or excluded, e.g. ".env.example".
+	Include []Pattern
+}
+
+// Pattern is a gitignore-style exclude or include pattern and the directory
+// it is relative to, like a line of the .gitignore file in that directory.
+type Pattern struct {
+	Pattern string
+	Dir     string // absolute path, or "" for the tree's root
+}
+
+// Patterns returns patterns relative to dir ("" for the tree's root).
+func Patterns(dir string, patterns ...string) []Pattern {
+	result := make([]Pattern, len(patterns))
+	for i, p := range patterns {
+		result[i] = Pattern{Pattern: p, Dir: dir}
+	}
+	return result
+}
+
+// DefaultExclude is hidden unless the options say otherwise: version
+// control internals and generated dependency and cache directories.
+var DefaultExclude = []string{".git", "node_modules", "__pycache__"}
+
+// DefaultOptions shows hidden files and hides ignored ones and
+// DefaultExclude.
+func DefaultOptions() Options {
+	return Options{
+		ShowHidden:       true,
+		RespectGitignore: true,
+		Exclude:          Patterns("", DefaultExclude...),
+	}
+}
+
+// Tree owns the settings and ignore file cache used to load the nodes under
+// one root directory. Its methods are safe to call from several goroutines,
+// e.g. RefreshIgnored from a background command while the UI loads
+// directories; the nodes themselves are not.
+type Tree struct {
+	root string // absolute path of the root directory
+	top  string // where ignore files are read from: the repository root, or root
+
+	mu      sync.Mutex
+	opts    Options
+	exclude []ignoreRule          // opts.Exclude, parsed
+	include []ignoreRule          // opts.Include, parsed
+	dirs    map[string]*ignoreSet // directory -> its own ignore files
+	repo    *ignoreSet            // global excludes and info/exclude (empty outside a repository)
+	loads   uint64                // bumped whenever a directory's children are loaded or dropped
+}
+
+// New returns a Tree for the directory at rootPath.
+func New(rootPath string, opts Options) (*Tree, error) {
+	absPath, err := filepath.Abs(rootPath)
+	if err != nil {
+		return nil, err
+	}
+	t := &Tree{
+		root: absPath,
+		top:  FindRepoRoot(absPath),
+		dirs: make(map[string]*ignoreSet),
+	}
+	if t.top == "" {
+		t.top = absPath
+	}
+	t.SetOptions(opts)
+	return t, nil
+}
+
+// Options returns the tree's current options. A nil Tree shows everything.
+func (t *Tree) Options() Options {
+	if t == nil {
+		return Options{ShowHidden: true}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.opts
+}
+
+// SetOptions changes the tree's options. Directories loaded from now on use
+// them; call Build again to apply them to the whole tree.
+func (t *Tree) SetOptions(opts Options) {
+	exclude := parsePatterns(opts.Exclude, t.root)
+	include := parsePatterns(opts.Include, t.root)
+	t.mu.Lock()
+	t.opts = opts
+	t.exclude, t.include = exclude, include
+	t.mu.Unlock()
+}
+
+// filter returns the options and parsed patterns for loading a directory.
+func (t *Tree) filter() (opts Options, exclude, include []ignoreRule) {
+	if t == nil {
+		return t.Options(), nil, nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.opts, t.exclude, t.include
+}
+
+// Loads returns a number that changes whenever a directory of the tree is
+// loaded, reloaded, moved, removed or unloaded, so callers can tell cheaply
+// whether the set of loaded directories may have changed. A nil Tree
+// always returns 0.
+func (t *Tree) Loads() uint64 {
+	if t == nil {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.loads
+}
+
+// countLoad records a change to the set of loaded directories.
+func (t *Tree) countLoad() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.loads++
+	t.mu.Unlock()
+}
+
+// Build creates the root node (only loads top level initially)
+func (t *Tree) Build() (*Node, error) {
+	info, err := os.Stat(t.root)
+	if err != nil {
+		return nil, err
+	}
+
+	root := &Node{
+		Name:     info.Name(),
+		Path:     ".",
+		AbsPath:  t.root,
+		IsDir:    info.IsDir(),
+		Expanded: true,
+		Depth:    0,
+		Loaded:   false,
+		tree:     t,
+	}
+
+	if root.IsDir {
+		err = loadChildren(root)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return root, nil
+}
+
+// Walk calls fn with the path (relative to the root, like Node.Path) of every
+// file the tree's options show, in the order the tree lists them. It loads
+// no nodes, so it can run in the background while the UI uses the tree.
+// Unreadable directories are skipped; if fn returns an error, the walk stops
+// and Walk returns it.
+func (t *Tree) Walk(fn func(path string) error) error {
+	opts, exclude, include := t.filter()
+	return t.walk(t.root, ".", opts, exclude, include, fn)
+}
+
+func (t *Tree) walk(abs, rel string, opts Options, exclude, include []ignoreRule, fn func(string) error) error {
+	entries, err := os.ReadDir(abs)
+	if err != nil {
+		return nil
+	}
+	var dirs, files []string
+	for _, entry := range entries {
+		if !t.shows(abs, entry, opts, exclude, include) {
+			continue
+		}
+		if entry.IsDir() {
+			dirs = append(dirs, entry.Name())
+		} else {
+			files = append(files, entry.Name())
+		}
+	}
+	byName := func(names []string) func(i, j int) bool {
+		return func(i, j int) bool { return strings.ToLower(names[i]) < strings.ToLower(names[j]) }
+	}
+	sort.Slice(dirs, byName(dirs))
+	sort.Slice(files, byName(files))
+
+	for _, name := range dirs {
+		if err := t.walk(filepath.Join(abs, name), filepath.Join(rel, name), opts, exclude, include, fn); err != nil {
+			return err
+		}
+	}
+	for _, name := range files {
+		if err := fn(filepath.Join(rel, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BuildTree creates a tree from a root path with DefaultOptions (only loads
+// top level initially)
+func BuildTree(rootPath string) (*Node, error) {
+	t, err := New(rootPath, DefaultOptions())
+	if err != nil {
+		return nil, err
+	}
+	return t.Build()
+}
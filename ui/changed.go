@@ -0,0 +1,104 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/almonk/bontree/tree"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// isChanged reports whether node has a (non-ignored) git status, either
+// itself or summarised from its children.
+func (m Model) isChanged(node *tree.Node) bool {
+	s := m.gitStatusOf(node).summary()
+	return s != gitUnchanged && s != gitIgnored
+}
+
+// visibleNodes flattens the tree, keeping only changed files and their
+// ancestors when the changed-files view is on.
+func (m *Model) visibleNodes() []*tree.Node {
+	nodes := flattenTree(m.root)
+	if !m.changedOnly {
+		return nodes
+	}
+	filtered := nodes[:0]
+	for _, node := range nodes {
+		if node == m.root || m.isChanged(node) {
+			filtered = append(filtered, node)
+		}
+	}
+	return filtered
+}
+
+// toggleChangedOnly switches the changed-files view on or off.
+func (m *Model) toggleChangedOnly() {
+	m.changedOnly = !m.changedOnly
+	if m.changedOnly {
+		m.changedSavedExpanded = make(map[*tree.Node]bool)
+		for _, dir := range tree.LoadedDirs(m.root) {
+			m.changedSavedExpanded[dir] = dir.Expanded
+		}
+		m.revealChanged()
+	} else {
+		// Directories loaded while revealing changes weren't expanded before
+		for _, dir := range tree.LoadedDirs(m.root) {
+			if dir != m.root {
+				dir.Expanded = m.changedSavedExpanded[dir]
+			}
+		}
+		m.changedSavedExpanded = nil
+	}
+	m.refreshFlatNodesKeepCursor()
+}
+
+// revealChanged loads and expands the ancestors of every changed file so
+// they show up in the changed-files view.
+func (m *Model) revealChanged() {
+	dirs := gitDirEntries(m.gitFiles)
+	for path, status := range m.gitFiles {
+		if dirs[path] || status.summary() == gitIgnored {
+			continue
+		}
+		node := m.root.Resolve(path)
+		if node == nil {
+			continue
+		}
+		for dir := node.Parent; dir != nil; dir = dir.Parent {
+			dir.Expand()
+		}
+	}
+}
+
+// changeCounts counts changed files (not directories) by their summary status.
+func (m Model) changeCounts() map[gitChange]int {
+	counts := make(map[gitChange]int)
+	dirs := gitDirEntries(m.gitFiles)
+	for path, status := range m.gitFiles {
+		if !dirs[path] {
+			counts[status.summary()]++
+		}
+	}
+	return counts
+}
+
+// renderChangeCounts renders the modified/added/deleted/untracked counts
+// for the status bar.
+func (m Model) renderChangeCounts() string {
+	counts := m.changeCounts()
+	segments := []struct {
+		change gitChange
+		color  lipgloss.TerminalColor
+	}{
+		{gitModified, colorBlue},
+		{gitAdded, colorGreen},
+		{gitDeleted, colorRed},
+		{gitUntracked, colorGreen},
+	}
+	var parts []string
+	for _, seg := range segments {
+		style := statusBase.Foreground(seg.color).Bold(true)
+		parts = append(parts, style.Render(fmt.Sprintf("%s%d", seg.change.letter(), counts[seg.change])))
+	}
+	return statusBase.Render(" ") + strings.Join(parts, statusBase.Render(" ")) + statusBase.Render(" ")
+}
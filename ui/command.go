@@ -0,0 +1,183 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/almonk/bontree/config"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// CommandRun is a user-defined command for the caller to run.
+type CommandRun struct {
+	Name   string
+	Mode   config.CommandMode
+	Script string // shell command line with placeholders expanded, run in the root
+	ID     int    // tells a pane command's output apart from earlier runs
+}
+
+// commandOutput is the output of a pane command, shown in place of the
+// tree until it is closed.
+type commandOutput struct {
+	id      int
+	name    string
+	script  string
+	cancel  func() // stops the running command
+	running bool
+	lines   []string
+	err     error // the command failed
+	scroll  int
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// commandScript expands cmd's placeholders for the cursor and marked paths.
+// Every value is shell-quoted, so paths with spaces stay one argument.
+func (m Model) commandScript(cmd config.Command) string {
+	cursor := m.flatNodes[m.cursor].Path
+	targets := m.targetPaths()
+	return expandPlaceholders(cmd.Run, func(name string) (string, bool) {
+		switch name {
+		case "files", "absfiles":
+			quoted := make([]string, len(targets))
+			for i, path := range targets {
+				if name == "absfiles" {
+					path, _ = m.pathPlaceholder(path, "abs")
+				}
+				quoted[i] = shellQuote(path)
+			}
+			return strings.Join(quoted, " "), true
+		case "contents":
+			return "", false
+		}
+		value, ok := m.pathPlaceholder(cursor, name)
+		return shellQuote(value), ok
+	})
+}
+
+// runCommand starts the named user command on the cursor (and marked) paths.
+func (m *Model) runCommand(name string) KeyResult {
+	cmd, ok := m.cfg.Command(name)
+	if !ok || len(m.flatNodes) == 0 {
+		return KeyResult{}
+	}
+	run := &CommandRun{Name: cmd.Name, Mode: cmd.Mode, Script: m.commandScript(cmd)}
+	if cmd.Mode == config.CommandPane {
+		m.closeOutput()
+		m.runs++
+		run.ID = m.runs
+		m.output = &commandOutput{id: run.ID, name: cmd.Name, script: run.Script, running: true}
+	}
+	return KeyResult{Command: run}
+}
+
+// closeOutput stops the pane command, if it's still running, and closes
+// its output.
+func (m *Model) closeOutput() {
+	if o := m.output; o != nil && o.cancel != nil {
+		o.cancel()
+	}
+	m.output = nil
+}
+
+// finishCommand records the result of the pane command run id. It reports
+// false if the pane was closed (or replaced) while the command ran.
+func (m *Model) finishCommand(id int, output string, err error) bool {
+	if m.output == nil || m.output.id != id || !m.output.running {
+		return false
+	}
+	m.output.running = false
+	m.output.cancel = nil
+	m.output.err = err
+	output = strings.TrimRight(strings.ReplaceAll(output, "\r\n", "\n"), "\n")
+	if output != "" {
+		m.output.lines = strings.Split(ansi.Strip(output), "\n")
+	}
+	return true
+}
+
+// commandSummary is a one-line result of a command for the status bar.
+func commandSummary(name, output string, err error) string {
+	last := ""
+	if lines := strings.Split(strings.TrimSpace(ansi.Strip(output)), "\n"); len(lines) > 0 {
+		last = strings.TrimSpace(lines[len(lines)-1])
+	}
+	if err != nil {
+		if last == "" {
+			return fmt.Sprintf("✗ %s: %s", name, err)
+		}
+		return fmt.Sprintf("✗ %s: %s", name, last)
+	}
+	if last == "" {
+		return fmt.Sprintf("✓ %s done", name)
+	}
+	return fmt.Sprintf("✓ %s: %s", name, last)
+}
+
+// handleOutputKey scrolls or closes the command output pane.
+func (m *Model) handleOutputKey(key string) KeyResult {
+	o := m.output
+	page := max(m.outputHeight()/2, 1)
+	switch action := m.cfg.ActionFor(key); {
+	case key == "esc" || action == config.ActionQuit:
+		m.closeOutput()
+		return KeyResult{}
+	case action == config.ActionMoveDown || action == config.ActionPreviewDown:
+		o.scroll++
+	case action == config.ActionMoveUp || action == config.ActionPreviewUp:
+		o.scroll--
+	case action == config.ActionHalfPageDown:
+		o.scroll += page
+	case action == config.ActionHalfPageUp:
+		o.scroll -= page
+	case action == config.ActionGoTop:
+		o.scroll = 0
+	case action == config.ActionGoBottom:
+		o.scroll = len(o.lines)
+	}
+	m.clampOutputScroll()
+	return KeyResult{}
+}
+
+// outputHeight is the number of output lines that fit below the header.
+func (m Model) outputHeight() int {
+	return max(m.height-2, 1) // header and hint
+}
+
+func (m *Model) clampOutputScroll() {
+	if o := m.output; o != nil {
+		o.scroll = min(o.scroll, len(o.lines)-m.outputHeight())
+		o.scroll = max(o.scroll, 0)
+	}
+}
+
+// outputView renders the command output pane over the whole screen.
+func (m Model) outputView() string {
+	o := m.output
+	status := fmt.Sprintf("%d lines", len(o.lines))
+	switch {
+	case o.running:
+		status = "running…"
+	case o.err != nil:
+		status = o.err.Error() + " · " + status
+	}
+	header := fmt.Sprintf(" $ %s · %s", o.script, status)
+
+	var b strings.Builder
+	b.WriteString(previewHeaderStyle.Render(padRight(ansi.Truncate(header, m.width, "…"), m.width)))
+	for row := 0; row < m.outputHeight(); row++ {
+		b.WriteString("\n")
+		line := ""
+		if i := o.scroll + row; i < len(o.lines) {
+			line = ansi.Truncate(" "+sanitizePreviewLine(o.lines[i]), m.width, "…")
+		}
+		b.WriteString(previewTextStyle.Render(padRight(line, m.width)))
+	}
+	b.WriteString("\n")
+	b.WriteString(lipgloss.NewStyle().Foreground(colorComment).Render(" j/k:scroll  g/G:top/bottom  esc:close"))
+	return b.String()
+}
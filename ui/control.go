@@ -0,0 +1,212 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/almonk/bontree/tree"
+)
+
+// controlRequest is one command received on the control socket, e.g.
+// {"cmd":"reveal","path":"ui/model.go"}.
+type controlRequest struct {
+	Cmd   string   `json:"cmd"`
+	Path  string   `json:"path,omitempty"`
+	Paths []string `json:"paths,omitempty"`
+	Query string   `json:"query,omitempty"`
+	Flat  bool     `json:"flat,omitempty"`
+}
+
+// controlResponse answers a request, or reports a change to subscribers
+// (Event is then set).
+type controlResponse struct {
+	OK    bool          `json:"ok"`
+	Error string        `json:"error,omitempty"`
+	Event string        `json:"event,omitempty"`
+	State *controlState `json:"state,omitempty"`
+}
+
+// controlState is the part of the UI state visible to control clients.
+type controlState struct {
+	Root   string   `json:"root"`
+	Cursor string   `json:"cursor"`
+	IsDir  bool     `json:"is_dir"`
+	Marks  []string `json:"marks"`
+	Filter string   `json:"filter"`
+}
+
+// controlState returns the current state for control clients. Paths are
+// relative to the root.
+func (m Model) controlState() controlState {
+	s := controlState{Filter: m.searchQuery, Marks: []string{}}
+	if absRoot, err := filepath.Abs(m.rootPath); err == nil {
+		s.Root = absRoot
+	}
+	if len(m.flatNodes) > 0 {
+		node := m.flatNodes[m.cursor]
+		s.Cursor = node.Path
+		s.IsDir = node.IsDir
+	}
+	if len(m.marks) > 0 {
+		s.Marks = m.targetPaths()
+	}
+	return s
+}
+
+// handleControl runs a control request against the model.
+func (m *Model) handleControl(req controlRequest) controlResponse {
+	var err error
+	switch req.Cmd {
+	case "reveal", "select":
+		err = m.reveal(req.Path)
+	case "expand", "collapse":
+		err = m.setExpanded(req.Path, req.Cmd == "expand")
+	case "filter":
+		m.setFilter(req.Query, req.Flat)
+	case "mark", "unmark":
+		err = m.markPaths(req.Paths, req.Cmd == "mark")
+	case "clear_marks":
+		m.clearMarks()
+	case "query", "subscribe":
+	default:
+		err = fmt.Errorf("unknown command %q", req.Cmd)
+	}
+	if err != nil {
+		return controlResponse{Error: err.Error()}
+	}
+	state := m.controlState()
+	return controlResponse{OK: true, State: &state}
+}
+
+// relPath converts a path given by a client, absolute or relative to the
+// root, into a tree path.
+func (m Model) relPath(path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("missing path")
+	}
+	if filepath.IsAbs(path) {
+		absRoot, err := filepath.Abs(m.rootPath)
+		if err != nil {
+			return "", err
+		}
+		rel, err := filepath.Rel(absRoot, path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return "", fmt.Errorf("%s is outside %s", path, absRoot)
+		}
+		path = rel
+	}
+	return strings.TrimPrefix(filepath.ToSlash(filepath.Clean(path)), "./"), nil
+}
+
+// reveal expands the ancestors of path and moves the cursor to it. If the
+// active filter or changed-files view hides it, they are turned off.
+func (m *Model) reveal(path string) error {
+	rel, err := m.relPath(path)
+	if err != nil {
+		return err
+	}
+	node := m.root.Resolve(rel)
+	if node == nil {
+		return fmt.Errorf("%s not found", rel)
+	}
+	for dir := node.Parent; dir != nil; dir = dir.Parent {
+		dir.Expand()
+	}
+
+	m.refreshFlatNodesKeepCursor()
+	if m.showsNode(node) {
+		m.restoreCursorPath(node.Path)
+		return nil
+	}
+	if m.searching || m.filtered {
+		m.searching = false
+		m.clearFilter()
+	}
+	if m.changedOnly {
+		m.toggleChangedOnly()
+	}
+	// Leaving those views restores the old expanded state and may unload
+	// the directories they loaded, so resolve and expand again
+	if node = m.root.Resolve(rel); node == nil {
+		return fmt.Errorf("%s not found", rel)
+	}
+	for dir := node.Parent; dir != nil; dir = dir.Parent {
+		dir.Expand()
+	}
+	m.refreshFlatNodes()
+	m.restoreCursorPath(node.Path)
+	return nil
+}
+
+// revealNearest reveals path or, if the tree leaves it out (a hidden or
+// ignored file, say), its nearest ancestor that is shown. It reports
+// whether path was left out; a path that doesn't exist is an error.
+func (m *Model) revealNearest(path string) (hidden bool, err error) {
+	if m.reveal(path) == nil {
+		return false, nil
+	}
+	rel, err := m.relPath(path)
+	if err != nil {
+		return false, err
+	}
+	if _, err := os.Lstat(filepath.Join(m.root.AbsPath, filepath.FromSlash(rel))); err != nil {
+		return false, fmt.Errorf("%s not found", rel)
+	}
+	for dir := filepath.Dir(rel); dir != "."; dir = filepath.Dir(dir) {
+		if m.reveal(dir) == nil {
+			break
+		}
+	}
+	return true, nil
+}
+
+// showsNode reports whether node is one of the visible rows.
+func (m Model) showsNode(node *tree.Node) bool {
+	for _, n := range m.flatNodes {
+		if n == node {
+			return true
+		}
+	}
+	return false
+}
+
+// setExpanded expands or collapses the directory at path.
+func (m *Model) setExpanded(path string, expanded bool) error {
+	rel, err := m.relPath(path)
+	if err != nil {
+		return err
+	}
+	node := m.root.Resolve(rel)
+	if node == nil || !node.IsDir {
+		return fmt.Errorf("%s is not a directory", rel)
+	}
+	if expanded {
+		for dir := node; dir != nil; dir = dir.Parent {
+			dir.Expand()
+		}
+	} else if node != m.root {
+		node.Collapse()
+	}
+	m.refreshFlatNodesKeepCursor()
+	return nil
+}
+
+// markPaths marks or unmarks each of paths.
+func (m *Model) markPaths(paths []string, marked bool) error {
+	for _, path := range paths {
+		rel, err := m.relPath(path)
+		if err != nil {
+			return err
+		}
+		node := m.root.Resolve(rel)
+		if node == nil {
+			return fmt.Errorf("%s not found", rel)
+		}
+		if m.markable(node) {
+			m.setMark(node.Path, marked)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/almonk/bontree/config"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// expandPlaceholders replaces each "{name}" in tmpl with lookup(name). The
+// value is looked up lazily, so expensive ones (like file contents) are only
+// computed when the template uses them. Unknown placeholders are kept as-is.
+func expandPlaceholders(tmpl string, lookup func(name string) (string, bool)) string {
+	var b strings.Builder
+	for {
+		open := strings.IndexByte(tmpl, '{')
+		if open < 0 {
+			break
+		}
+		end := strings.IndexByte(tmpl[open:], '}')
+		if end < 0 {
+			break
+		}
+		b.WriteString(tmpl[:open])
+		name := tmpl[open+1 : open+end]
+		if value, ok := lookup(name); ok {
+			b.WriteString(value)
+		} else {
+			b.WriteString(tmpl[open : open+end+1])
+		}
+		tmpl = tmpl[open+end+1:]
+	}
+	b.WriteString(tmpl)
+	return b.String()
+}
+
+// pathPlaceholder returns the value of a path placeholder for the node at
+// relPath: {path}, {abs}, {name}, {dir}, {ext}, {root}, {line} or
+// {contents}.
+func (m Model) pathPlaceholder(relPath, name string) (string, bool) {
+	absRoot, err := filepath.Abs(m.rootPath)
+	if err != nil {
+		absRoot = m.rootPath
+	}
+	switch name {
+	case "path":
+		return relPath, true
+	case "abs":
+		return filepath.Join(absRoot, filepath.FromSlash(relPath)), true
+	case "name":
+		return filepath.Base(relPath), true
+	case "dir":
+		if dir := parentDir(relPath); dir != "" {
+			return dir, true
+		}
+		return ".", true
+	case "ext":
+		return strings.TrimPrefix(filepath.Ext(relPath), "."), true
+	case "root":
+		return absRoot, true
+	case "line":
+		return strconv.Itoa(m.previewLine(relPath)), true
+	case "contents":
+		return m.fileContents(relPath), true
+	}
+	return "", false
+}
+
+// previewLine is the first line shown in the preview when it displays the
+// contents of relPath, and 1 otherwise.
+func (m Model) previewLine(relPath string) int {
+	if m.showPreview && m.preview != nil && m.preview.path == relPath && !m.preview.diff {
+		return m.previewScroll + 1
+	}
+	return 1
+}
+
+// fileContents returns up to previewMaxBytes of a file, or "" for
+// directories and unreadable files.
+func (m Model) fileContents(relPath string) string {
+	if m.demoFiles != nil {
+		return strings.TrimSuffix(m.demoFiles[relPath], "\n")
+	}
+	f, err := os.Open(filepath.Join(m.rootPath, filepath.FromSlash(relPath)))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, previewMaxBytes))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(string(data), "\n")
+}
+
+// copyAs copies the marked paths (or the cursor path) using format.
+func (m *Model) copyAs(format config.CopyFormat) KeyResult {
+	paths := m.targetPaths()
+	if len(paths) == 0 {
+		return KeyResult{}
+	}
+	refs := make([]string, len(paths))
+	for i, path := range paths {
+		path = strings.TrimPrefix(path, "./")
+		refs[i] = expandPlaceholders(format.Template, func(name string) (string, bool) {
+			return m.pathPlaceholder(path, name)
+		})
+	}
+	text := strings.Join(refs, m.cfg.CopySeparator)
+	if len(refs) > 1 {
+		return KeyResult{CopyPath: text, FlashMsg: fmt.Sprintf("✓ Copied %d paths as %s", len(refs), format.Name)}
+	}
+	return KeyResult{CopyPath: text, FlashMsg: fmt.Sprintf("✓ Copied %s: %s", format.Name, firstLine(text))}
+}
+
+// copyFormatByName copies with the named format from the config.
+func (m *Model) copyFormatByName(name string) KeyResult {
+	format, ok := m.cfg.CopyFormat(name)
+	if !ok {
+		return KeyResult{FlashMsg: fmt.Sprintf("Unknown copy format %q", name)}
+	}
+	return m.copyAs(format)
+}
+
+// handleCopyMenuKey picks a format from the open copy menu by its number.
+func (m *Model) handleCopyMenuKey(key string) KeyResult {
+	m.copyMenu = false
+	if n, err := strconv.Atoi(key); err == nil && n >= 1 && n <= len(m.cfg.CopyFormats) && n <= 9 {
+		return m.copyAs(m.cfg.CopyFormats[n-1])
+	}
+	return KeyResult{}
+}
+
+// renderCopyMenu renders the copy menu line shown above the status bar.
+func (m Model) renderCopyMenu() string {
+	var b strings.Builder
+	b.WriteString(searchPromptStyle.Render("copy"))
+	for i, f := range m.cfg.CopyFormats {
+		if i == 9 {
+			break
+		}
+		b.WriteString(searchPromptStyle.Render(strconv.Itoa(i + 1)))
+		b.WriteString(searchInputStyle.Render(f.Name))
+	}
+	line := ansi.Truncate(b.String(), m.width, "…")
+	if w := lipgloss.Width(line); w < m.width {
+		line += statusBase.Render(strings.Repeat(" ", m.width-w))
+	}
+	return line
+}
@@ -1,6 +1,8 @@
 package ui
 
 import (
+	"strings"
+
 	"github.com/almonk/bontree/config"
 	"github.com/almonk/bontree/tree"
 )
@@ -20,9 +22,42 @@ func NewDemo(root *tree.Node, cfg *config.Config) Model {
 }
 
 // SetGitInfo sets the git branch and file status for demo display.
+// Statuses only need to be given for files; parent directories are filled in.
 func (m *Model) SetGitInfo(branch string, files map[string]GitFileStatus) {
 	m.gitBranch = branch
-	m.gitFiles = files
+	m.gitFiles = make(map[string]gitFileStatus, len(files))
+	for path, status := range files {
+		m.gitFiles[path] = status
+	}
+	propagateGitStatus(m.gitFiles)
+}
+
+// SetFileContents provides file contents (keyed by node path) for the
+// preview pane, since the demo tree has no files on disk.
+func (m *Model) SetFileContents(files map[string]string) {
+	m.demoFiles = files
+}
+
+// SetFileDiffs provides diffs against HEAD (keyed by node path) for the
+// preview pane's diff mode.
+// Line counts shown next to changed files are derived from the diffs.
+func (m *Model) SetFileDiffs(diffs map[string]string) {
+	m.demoDiffs = diffs
+	m.gitLines = make(map[string]lineCount)
+	for path, diff := range diffs {
+		var c lineCount
+		for _, line := range strings.Split(diff, "\n") {
+			switch {
+			case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+			case strings.HasPrefix(line, "+"):
+				c.added++
+			case strings.HasPrefix(line, "-"):
+				c.removed++
+			}
+		}
+		m.gitLines[path] = c
+	}
+	propagateLineCounts(m.gitLines)
 }
 
 // SetFlash sets a flash message (caller is responsible for clearing it later).
@@ -30,11 +65,21 @@ func (m *Model) SetFlash(msg string) {
 	m.flashMsg = msg
 }
 
-// GitFileStatus is the exported type for git file status constants.
+// GitFileStatus is the exported type for a file's staged/unstaged git status.
 type GitFileStatus = gitFileStatus
 
-// Exported git status constants for demo use.
+// GitChange is the exported type for git change constants.
+type GitChange = gitChange
+
+// GitStatus builds a file status from its staged (index) and unstaged
+// (worktree) changes.
+func GitStatus(staged, unstaged GitChange) GitFileStatus {
+	return gitFileStatus{index: staged, worktree: unstaged}
+}
+
+// Exported git change constants for demo use.
 const (
+	GitUnchanged = gitUnchanged
 	GitModified  = gitModified
 	GitAdded     = gitAdded
 	GitDeleted   = gitDeleted
@@ -0,0 +1,327 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/almonk/bontree/tree"
+)
+
+// inputPath turns a path typed into a prompt, relative to the root, into a
+// tree path. Paths outside the root are refused.
+func (m Model) inputPath(value string) (string, error) {
+	rel, err := m.relPath(strings.TrimSpace(value))
+	if err != nil {
+		return "", err
+	}
+	if rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", fmt.Errorf("%s is outside the tree", value)
+	}
+	return filepath.FromSlash(rel), nil
+}
+
+// dirPrefix returns the tree path of a directory as typed in a prompt, with
+// a trailing slash ("" for the root).
+func dirPrefix(rel string) string {
+	if rel == "." {
+		return ""
+	}
+	return filepath.ToSlash(rel) + "/"
+}
+
+// fileTargets returns the nodes a file action applies to: the marked nodes,
+// or the cursor node. The root is never included.
+func (m *Model) fileTargets() []*tree.Node {
+	var nodes []*tree.Node
+	for _, path := range m.targetPaths() {
+		if node := m.root.Resolve(path); node != nil && m.markable(node) {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// nodePaths returns the paths of nodes.
+func nodePaths(nodes []*tree.Node) []string {
+	paths := make([]string, len(nodes))
+	for i, node := range nodes {
+		paths[i] = node.Path
+	}
+	return paths
+}
+
+// startCreate prompts for a file or directory to create. The path is
+// relative to the root and starts out as the cursor's directory; missing
+// parent directories are created too, and a trailing slash always makes a
+// directory.
+func (m *Model) startCreate(dir bool) KeyResult {
+	if m.tree == nil || len(m.flatNodes) == 0 {
+		return KeyResult{}
+	}
+	parent := m.flatNodes[m.cursor]
+	if !parent.IsDir {
+		parent = parent.Parent
+	}
+	prompt := "new file"
+	if dir {
+		prompt = "new dir"
+	}
+	m.startInput(prompt, dirPrefix(parent.Path), func(m *Model, value string) KeyResult {
+		return m.createPath(value, dir || strings.HasSuffix(value, "/"))
+	})
+	return KeyResult{}
+}
+
+// createPath creates the file or directory at the typed path and moves the
+// cursor to it.
+func (m *Model) createPath(value string, dir bool) KeyResult {
+	rel, err := m.inputPath(value)
+	if err != nil {
+		return KeyResult{FlashMsg: fmt.Sprintf("✗ Create: %s", err)}
+	}
+	abs := filepath.Join(m.root.AbsPath, rel)
+	if _, err := os.Lstat(abs); err == nil {
+		return KeyResult{FlashMsg: fmt.Sprintf("✗ %s already exists", rel)}
+	}
+	// Remember which directories are new, so undo can remove them
+	parents := missingDirs(filepath.Dir(abs))
+	if err := os.MkdirAll(filepath.Dir(abs), 0o755); err != nil {
+		return KeyResult{FlashMsg: fmt.Sprintf("✗ Create: %s", err)}
+	}
+	if dir {
+		err = os.Mkdir(abs, 0o755)
+	} else {
+		var f *os.File
+		if f, err = os.OpenFile(abs, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644); err == nil {
+			err = f.Close()
+		}
+	}
+	if err != nil {
+		return KeyResult{FlashMsg: fmt.Sprintf("✗ Create: %s", err)}
+	}
+
+	m.journal.record("create "+rel, fileChange{kind: changeCreate, path: abs, parents: parents})
+	m.reloadAncestor(rel)
+	return KeyResult{RefreshGit: true, FlashMsg: "✓ Created " + rel + m.afterFileOp(rel)}
+}
+
+// startRename prompts for a new name for the cursor node.
+func (m *Model) startRename() KeyResult {
+	if m.tree == nil || len(m.flatNodes) == 0 {
+		return KeyResult{}
+	}
+	node := m.flatNodes[m.cursor]
+	if !m.markable(node) {
+		return KeyResult{FlashMsg: "Can't rename the root"}
+	}
+	m.startInput("rename", node.Name, func(m *Model, value string) KeyResult {
+		return m.rename(node, strings.TrimSpace(value))
+	})
+	return KeyResult{}
+}
+
+// rename renames node within its directory.
+func (m *Model) rename(node *tree.Node, name string) KeyResult {
+	if name == "" || name == node.Name {
+		return KeyResult{}
+	}
+	if name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return KeyResult{FlashMsg: fmt.Sprintf("✗ %q isn't a file name (use move to change directory)", name)}
+	}
+	oldName := node.Name
+	change, err := m.moveNode(node, node.Parent, name)
+	if err != nil {
+		return KeyResult{FlashMsg: fmt.Sprintf("✗ Rename: %s", err)}
+	}
+	m.journal.record("rename "+oldName, change)
+	return KeyResult{RefreshGit: true, FlashMsg: "✓ Renamed to " + name + m.afterFileOp(node.Path)}
+}
+
+// startMove prompts for the directory to move the marked nodes, or the
+// cursor node, into. A directory that doesn't exist yet is created.
+func (m *Model) startMove() KeyResult {
+	if m.tree == nil {
+		return KeyResult{}
+	}
+	nodes := m.fileTargets()
+	if len(nodes) == 0 {
+		return KeyResult{}
+	}
+	prompt := fmt.Sprintf("move %s to", describePaths(nodePaths(nodes)))
+	m.startInput(prompt, dirPrefix(nodes[0].Parent.Path), func(m *Model, value string) KeyResult {
+		return m.moveTo(nodes, value)
+	})
+	return KeyResult{}
+}
+
+// moveTo moves nodes into the typed directory and moves the cursor to the
+// first of them.
+func (m *Model) moveTo(nodes []*tree.Node, value string) KeyResult {
+	rel, err := m.inputPath(value)
+	if err != nil {
+		return KeyResult{FlashMsg: fmt.Sprintf("✗ Move: %s", err)}
+	}
+	abs := filepath.Join(m.root.AbsPath, rel)
+	if info, err := os.Stat(abs); err == nil && !info.IsDir() {
+		return KeyResult{FlashMsg: fmt.Sprintf("✗ Move: %s is not a directory", rel)}
+	}
+	parents := missingDirs(abs)
+	if err := os.MkdirAll(abs, 0o755); err != nil {
+		return KeyResult{FlashMsg: fmt.Sprintf("✗ Move: %s", err)}
+	}
+	m.reloadAncestor(rel)
+	dest := m.root.Resolve(rel)
+	if dest == nil {
+		// Filtered out of the tree; the moved nodes just disappear
+		dest = &tree.Node{Path: rel, AbsPath: abs, IsDir: true}
+	}
+
+	var moved []string
+	var changes []fileChange
+	first := ""
+	for _, node := range nodes {
+		if node.Parent != nil && node.Parent.AbsPath == dest.AbsPath {
+			continue
+		}
+		change, err := m.moveNode(node, dest, node.Name)
+		if err != nil {
+			if len(changes) == 0 {
+				removeEmptyDirs(parents)
+				m.reloadAncestor(rel)
+			}
+			m.journal.record("move "+describePaths(moved), changes...)
+			m.afterFileOp(first)
+			return KeyResult{RefreshGit: len(moved) > 0, FlashMsg: fmt.Sprintf("✗ Move %s: %s", node.Name, err)}
+		}
+		if first == "" {
+			// Undoing the first move, which comes last, removes the
+			// directories created for it
+			first = node.Path
+			change.parents = parents
+		}
+		moved = append(moved, node.Name)
+		changes = append(changes, change)
+	}
+	m.journal.record("move "+describePaths(moved), changes...)
+	if len(moved) == 0 {
+		return KeyResult{FlashMsg: "Nothing to move"}
+	}
+	msg := fmt.Sprintf("✓ Moved %s to %s", describePaths(moved), dirLabel(rel))
+	return KeyResult{RefreshGit: true, FlashMsg: msg + m.afterFileOp(first)}
+}
+
+// missingDirs returns dir and those of its parents that don't exist yet,
+// outermost first.
+func missingDirs(dir string) []string {
+	var dirs []string
+	for ; ; dir = filepath.Dir(dir) {
+		if _, err := os.Lstat(dir); err == nil {
+			break
+		}
+		dirs = append([]string{dir}, dirs...)
+	}
+	return dirs
+}
+
+// moveNode renames node on disk to name inside dir and moves it in the
+// tree, keeping its marks. It returns the change for the journal.
+func (m *Model) moveNode(node, dir *tree.Node, name string) (fileChange, error) {
+	change := fileChange{kind: changeMove, from: node.AbsPath, path: filepath.Join(dir.AbsPath, name)}
+	if info, err := os.Lstat(change.path); err == nil {
+		// Allow changing only the case on case-insensitive filesystems
+		if src, err := os.Lstat(node.AbsPath); err != nil || !os.SameFile(src, info) {
+			return change, fmt.Errorf("%s already exists", name)
+		}
+	}
+	if node.IsDir && strings.HasPrefix(change.path+string(filepath.Separator), node.AbsPath+string(filepath.Separator)) {
+		return change, fmt.Errorf("can't move %s into itself", node.Name)
+	}
+	if err := moveFile(change.from, change.path, nil); err != nil {
+		return change, err
+	}
+
+	oldPath := node.Path
+	node.Move(dir, name)
+	if dir.Loaded {
+		// Drop it again if the new name is filtered out
+		dir.Reload()
+	}
+	m.moveMarks(oldPath, node.Path)
+	return change, nil
+}
+
+// moveMarks carries marks at or under oldPath over to newPath.
+func (m *Model) moveMarks(oldPath, newPath string) {
+	prefix := oldPath + string(filepath.Separator)
+	for path := range m.marks {
+		if path == oldPath {
+			delete(m.marks, path)
+			m.marks[newPath] = true
+		} else if rest, ok := strings.CutPrefix(path, prefix); ok {
+			delete(m.marks, path)
+			m.marks[filepath.Join(newPath, rest)] = true
+		}
+	}
+}
+
+// startTrash asks before moving the marked nodes, or the cursor node, to
+// the trash.
+func (m *Model) startTrash() KeyResult {
+	if m.tree == nil {
+		return KeyResult{}
+	}
+	nodes := m.fileTargets()
+	if len(nodes) == 0 {
+		return KeyResult{}
+	}
+	msg := fmt.Sprintf("Move %s to the trash", describePaths(nodePaths(nodes)))
+	m.startConfirm(msg, func(m *Model) KeyResult {
+		return m.trash(nodes)
+	})
+	return KeyResult{}
+}
+
+// trash moves nodes to the trash. It runs in the background like a paste,
+// since the trash may be on another filesystem, which means copying.
+func (m *Model) trash(nodes []*tree.Node) KeyResult {
+	if m.pasting != nil {
+		return KeyResult{FlashMsg: "✗ Wait for the paste to finish"}
+	}
+	op := PasteOp{Trash: true}
+	for _, node := range nodes {
+		op.Items = append(op.Items, PasteItem{Src: node.AbsPath})
+	}
+	return m.startPaste(op)
+}
+
+// reloadAncestor reloads the nearest loaded directory above rel, after
+// entries (and maybe missing parents) were created on the way to it.
+func (m *Model) reloadAncestor(rel string) {
+	for dir := filepath.Dir(rel); ; dir = filepath.Dir(dir) {
+		if node := m.root.Find(dir); node != nil {
+			node.Reload()
+			return
+		}
+		if dir == "." {
+			return
+		}
+	}
+}
+
+// afterFileOp refreshes the rows after the tree was changed on disk and
+// moves the cursor to path (if not ""). It returns a note to add to the
+// flash message when path is filtered out of the tree.
+func (m *Model) afterFileOp(path string) string {
+	m.visualAnchor = nil
+	m.preview = nil
+	m.refreshFlatNodesKeepCursor()
+	if path == "" {
+		return ""
+	}
+	if hidden, err := m.revealNearest(path); hidden || err != nil {
+		return " (hidden)"
+	}
+	return ""
+}
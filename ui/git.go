@@ -3,6 +3,8 @@
 package ui
 
 import (
+	"errors"
+	"fmt"
 	"os/exec"
 	"strings"
 	"time"
@@ -13,8 +15,11 @@ import (
 
 type gitRefreshMsg struct{}
 type gitInfoMsg struct {
-	branch     string
-	fileStatus map[string]gitFileStatus // relative path -> status
+	branch         string
+	fileStatus     map[string]gitFileStatus // relative path -> status
+	lineCounts     map[string]lineCount     // relative path -> lines added/removed
+	ignoredChanged bool                     // an ignore file changed
+	err            error                    // comparing against the base ref failed
 }
 
 func gitRefreshTick() tea.Cmd {
@@ -23,16 +28,31 @@ func gitRefreshTick() tea.Cmd {
 	})
 }
 
-func fetchGitInfo(path string) tea.Cmd {
+func fetchGitInfo(t *tree.Tree, lines *lineCache, path, base string) tea.Cmd {
 	return func() tea.Msg {
-		tree.RefreshGitIgnored(path)
+		ignoredChanged := t.RefreshIgnored()
+		fileStatus, err := getGitFileStatus(path, base)
 		return gitInfoMsg{
-			branch:     getGitBranch(path),
-			fileStatus: getGitFileStatus(path),
+			branch:         getGitBranch(path),
+			fileStatus:     fileStatus,
+			lineCounts:     getGitLineCounts(path, base, lines),
+			ignoredChanged: ignoredChanged,
+			err:            err,
 		}
 	}
 }
 
+// requestGitInfo starts a git status fetch unless one is already running,
+// in which case the running fetch is marked stale and repeated on arrival.
+func (m *Model) requestGitInfo() tea.Cmd {
+	if m.gitPending {
+		m.gitStale = true
+		return nil
+	}
+	m.gitPending = true
+	return fetchGitInfo(m.tree, m.lineCache, m.rootPath, m.baseRef)
+}
+
 func getGitBranch(path string) string {
 	// Try rev-parse first (works when there are commits)
 	for _, args := range [][]string{
@@ -49,61 +69,170 @@ func getGitBranch(path string) string {
 	return ""
 }
 
-func getGitFileStatus(path string) map[string]gitFileStatus {
-	out, err := exec.Command("git", "-C", path, "status", "--porcelain", "--ignored").Output()
+// getGitFileStatus returns the status of every changed file under path,
+// keyed by path relative to it. When base is set, each file's change
+// against that ref is recorded too; the error reports a bad base ref.
+func getGitFileStatus(path, base string) (map[string]gitFileStatus, error) {
+	out, err := exec.Command("git", "-C", path, "--no-optional-locks", "status", "--porcelain", "--ignored").Output()
 	if err != nil {
-		return nil
+		return nil, nil
 	}
-	result := make(map[string]gitFileStatus)
-	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
-		if len(line) < 4 {
-			continue
-		}
-		x, y := line[0], line[1]
-		file := strings.TrimSpace(line[3:])
-		// Handle renames: "R  old -> new"
-		if idx := strings.Index(file, " -> "); idx >= 0 {
-			file = file[idx+4:]
+	// Porcelain paths are relative to the repository root, not to path
+	result := parsePorcelain(string(out), gitPrefix(path))
+
+	if base != "" {
+		err = verifyRef(path, base)
+		if err == nil {
+			err = addBaseChanges(path, base, result)
 		}
+	}
+	propagateGitStatus(result)
+	return result, err
+}
+
+// verifyRef checks that ref names a commit, so it can't be taken for an
+// option or a path by the commands it's passed to.
+func verifyRef(path, ref string) error {
+	err := exec.Command("git", "-C", path, "rev-parse", "--verify", "--quiet", "--end-of-options", ref+"^{commit}").Run()
+	if err != nil {
+		return errors.New("not a commit")
+	}
+	return nil
+}
 
-		var status gitFileStatus
-		switch {
-		case x == '!' || y == '!':
-			status = gitIgnored
-		case x == '?' || y == '?':
-			status = gitUntracked
-		case x == 'D' || y == 'D':
-			status = gitDeleted
-		case x == 'A' || x == '?':
-			status = gitAdded
-		case x == 'M' || y == 'M' || x == 'R':
-			status = gitModified
-		default:
-			status = gitModified
+// addBaseChanges records each file's change between base and the working
+// tree, which includes changes that have already been committed.
+func addBaseChanges(path, base string, result map[string]gitFileStatus) error {
+	cmd := exec.Command("git", "-C", path, "--no-optional-locks", "diff", "--name-status", "--relative", "-M", "--end-of-options", base, "--")
+	out, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return fmt.Errorf("%s", firstLine(strings.TrimSpace(string(exitErr.Stderr))))
+		}
+		return err
+	}
+	for _, line := range strings.Split(strings.TrimRight(string(out), "\n"), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) < 2 || fields[0] == "" {
+			continue
 		}
+		// Renames and copies list "old\tnew"; the new path is what's on disk
+		file := fields[len(fields)-1]
+		status := result[file]
+		status.base = parseGitChange(fields[0][0])
 		result[file] = status
+	}
+	return nil
+}
 
-		// Propagate to parent directories (skip ignored — don't dim parent dirs)
-		if status != gitIgnored {
-			dir := file
-			for {
-				dir = parentDir(dir)
-				if dir == "" {
-					break
-				}
-				// Dirs get the highest-priority status of their children
-				if existing, ok := result[dir]; !ok || status > existing {
-					result[dir] = status
+// getGitLineCounts returns the lines added/removed per file relative to
+// base (HEAD if empty). Untracked files, including those inside untracked
+// directories, count every line as added; cache saves re-reading the ones
+// that haven't changed.
+func getGitLineCounts(path, base string, cache *lineCache) map[string]lineCount {
+	if base == "" {
+		base = "HEAD"
+	}
+	out, err := exec.Command("git", "-C", path, "--no-optional-locks", "diff", "--numstat", "--relative", "--no-renames", "--end-of-options", base, "--").Output()
+	if err != nil {
+		out = nil
+	}
+	counts := parseNumstat(string(out))
+
+	// Unlike status, ls-files lists every file in an untracked directory
+	out, err = exec.Command("git", "-C", path, "ls-files", "-z", "--others", "--exclude-standard").Output()
+	if err != nil {
+		out = nil
+	}
+	var untracked []string
+	for _, file := range strings.Split(string(out), "\x00") {
+		if file != "" {
+			untracked = append(untracked, file)
+		}
+	}
+	for file, n := range cache.count(path, untracked) {
+		counts[file] = lineCount{added: n}
+	}
+
+	propagateLineCounts(counts)
+	return counts
+}
+
+// gitPrefix returns path's location inside its repository, e.g. "sub/dir/".
+func gitPrefix(path string) string {
+	out, err := exec.Command("git", "-C", path, "rev-parse", "--show-prefix").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// gitOpDoneMsg is sent when a git operation started from the tree finishes.
+type gitOpDoneMsg struct{ err error }
+
+// runGitOp executes op in the repository at rootPath.
+func runGitOp(rootPath string, op GitOp) tea.Cmd {
+	return func() tea.Msg {
+		var cmds [][]string
+		switch op.Action {
+		case GitStage:
+			cmds = append(cmds, append([]string{"add", "-A", "--"}, op.Paths...))
+		case GitUnstage:
+			cmds = append(cmds, append([]string{"restore", "--staged", "--"}, op.Paths...))
+		case GitDiscard:
+			if len(op.Paths) > 0 {
+				cmds = append(cmds, append([]string{"restore", "--worktree", "--"}, op.Paths...))
+			}
+			if len(op.Untracked) > 0 {
+				cmds = append(cmds, append([]string{"clean", "-f", "-d", "--"}, op.Untracked...))
+			}
+		}
+		for _, args := range cmds {
+			cmd := exec.Command("git", append([]string{"-C", rootPath}, args...)...)
+			if out, err := cmd.CombinedOutput(); err != nil {
+				if msg := strings.TrimSpace(string(out)); msg != "" {
+					return gitOpDoneMsg{err: fmt.Errorf("%s", firstLine(msg))}
 				}
+				return gitOpDoneMsg{err: err}
 			}
 		}
+		return gitOpDoneMsg{}
 	}
-	return result
 }
 
-func parentDir(path string) string {
-	if i := strings.LastIndexByte(path, '/'); i > 0 {
-		return path[:i]
+// previewDiffMsg carries the diff of the previewed file, fetched in the
+// background.
+type previewDiffMsg struct {
+	path    string
+	modTime time.Time // of the file when the diff was requested
+	diff    string
+	err     error
+}
+
+// requestDiff returns a command fetching the diff the preview is waiting
+// for, or nil if it isn't waiting or already asked. The diff is keyed by
+// the file's modification time, so it waits for the contents to load.
+func (m Model) requestDiff() tea.Cmd {
+	p := m.preview
+	if p == nil || !p.diffPending || p.diffRequested || p.loadPending {
+		return nil
 	}
-	return ""
+	p.diffRequested = true
+	rootPath, base, path, modTime := m.rootPath, m.baseRef, p.path, p.modTime
+	return func() tea.Msg {
+		diff, err := gitDiff(rootPath, base, path)
+		return previewDiffMsg{path: path, modTime: modTime, diff: diff, err: err}
+	}
+}
+
+// gitDiff returns the unified diff of relPath against base (HEAD if empty).
+func gitDiff(rootPath, base, relPath string) (string, error) {
+	if base == "" {
+		base = "HEAD"
+	}
+	out, err := exec.Command("git", "-C", rootPath, "--no-optional-locks", "diff", "--no-color", "--no-ext-diff", "--end-of-options", base, "--", relPath).Output()
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
 }
@@ -0,0 +1,193 @@
+package ui
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// GitAction is a change to the git index or worktree.
+type GitAction int
+
+const (
+	GitStage   GitAction = iota // git add
+	GitUnstage                  // git restore --staged
+	GitDiscard                  // git restore (and git clean for untracked files)
+)
+
+// verb returns the action as a lowercase verb, e.g. "stage".
+func (a GitAction) verb() string {
+	switch a {
+	case GitUnstage:
+		return "unstage"
+	case GitDiscard:
+		return "discard"
+	}
+	return "stage"
+}
+
+// past returns the capitalised past tense of the action, e.g. "Staged".
+func (a GitAction) past() string {
+	switch a {
+	case GitUnstage:
+		return "Unstaged"
+	case GitDiscard:
+		return "Discarded"
+	}
+	return "Staged"
+}
+
+// GitOp describes a git operation for the caller to run. Paths are
+// relative to the root path.
+type GitOp struct {
+	Action    GitAction
+	Paths     []string // tracked files (or all files, for GitStage)
+	Untracked []string // untracked files to delete (GitDiscard only)
+}
+
+// all returns every path the operation touches.
+func (op GitOp) all() []string {
+	return append(append([]string(nil), op.Paths...), op.Untracked...)
+}
+
+// gitTargets returns the changed files at or under any of rels that action
+// applies to, split into tracked and untracked paths.
+func (m *Model) gitTargets(rels []string, action GitAction) (tracked, untracked []string) {
+	dirs := gitDirEntries(m.gitFiles)
+	for path, status := range m.gitFiles {
+		if dirs[path] || !underAny(path, rels) {
+			continue
+		}
+		switch action {
+		case GitStage:
+			if status.worktree != gitUnchanged && status.worktree != gitIgnored {
+				tracked = append(tracked, path)
+			}
+		case GitUnstage:
+			if status.index == gitModified || status.index == gitAdded || status.index == gitDeleted {
+				tracked = append(tracked, path)
+			}
+		case GitDiscard:
+			switch status.worktree {
+			case gitModified, gitDeleted:
+				tracked = append(tracked, path)
+			case gitUntracked:
+				untracked = append(untracked, path)
+			}
+		}
+	}
+	sort.Strings(tracked)
+	sort.Strings(untracked)
+	return tracked, untracked
+}
+
+// underAny reports whether path is one of rels or inside one of them.
+func underAny(path string, rels []string) bool {
+	for _, rel := range rels {
+		rel = strings.TrimPrefix(rel, "./")
+		if rel == "." || path == rel || strings.HasPrefix(path, rel+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// startGitOp builds the operation for the marked nodes, or the cursor node
+// if nothing is marked. Stage and unstage run immediately; discard asks for
+// confirmation first.
+func (m *Model) startGitOp(action GitAction) KeyResult {
+	rels := m.targetPaths()
+	if len(rels) == 0 {
+		return KeyResult{}
+	}
+	tracked, untracked := m.gitTargets(rels, action)
+	if len(tracked)+len(untracked) == 0 {
+		return KeyResult{FlashMsg: fmt.Sprintf("Nothing to %s", action.verb())}
+	}
+
+	op := GitOp{Action: action, Paths: tracked, Untracked: untracked}
+	if action == GitDiscard {
+		msg := fmt.Sprintf("Discard changes to %s", describePaths(op.all()))
+		if len(untracked) > 0 {
+			msg += fmt.Sprintf(" (deletes %d untracked)", len(untracked))
+		}
+		m.startConfirm(msg, func(m *Model) KeyResult { return m.discard(op) })
+		return KeyResult{}
+	}
+	return m.runGitOp(op)
+}
+
+// runGitOp updates the status map optimistically and hands the operation to
+// the caller to execute.
+func (m *Model) runGitOp(op GitOp) KeyResult {
+	// Drop the directory summaries, update the files, then summarise again
+	for dir := range gitDirEntries(m.gitFiles) {
+		delete(m.gitFiles, dir)
+	}
+	for _, path := range op.Paths {
+		status := m.gitFiles[path]
+		switch op.Action {
+		case GitStage:
+			status = status.staged()
+		case GitUnstage:
+			status = status.unstaged()
+		case GitDiscard:
+			status = status.discarded()
+		}
+		if status == (gitFileStatus{}) {
+			delete(m.gitFiles, path)
+		} else {
+			m.gitFiles[path] = status
+		}
+	}
+	for _, path := range op.Untracked {
+		delete(m.gitFiles, path)
+	}
+	propagateGitStatus(m.gitFiles)
+	if m.changedOnly {
+		m.refreshFlatNodesKeepCursor()
+	}
+
+	return KeyResult{Git: &op, FlashMsg: fmt.Sprintf("✓ %s %s", op.Action.past(), describePaths(op.all()))}
+}
+
+// discard saves the files op is about to discard, so it can be undone, and
+// runs it.
+func (m *Model) discard(op GitOp) KeyResult {
+	paths := op.all()
+	abs := make([]string, len(paths))
+	for i, path := range paths {
+		abs[i] = filepath.Join(m.root.AbsPath, filepath.FromSlash(path))
+	}
+	backups, err := m.journal.backup(abs)
+	if err != nil {
+		return KeyResult{FlashMsg: fmt.Sprintf("✗ Can't save files for undo: %s", err)}
+	}
+	m.journal.record("discard "+describePaths(paths), fileChange{kind: changeDiscard, op: op, backups: backups})
+	return m.runGitOp(op)
+}
+
+// setBaseRef switches the ref git status is compared against. An empty
+// value goes back to comparing against HEAD.
+func setBaseRef(m *Model, value string) KeyResult {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "-") {
+		return KeyResult{FlashMsg: fmt.Sprintf("✗ %q is not a git ref", value)}
+	}
+	m.baseRef = value
+	m.baseErr = ""
+	m.preview = nil
+	if m.baseRef == "" {
+		return KeyResult{RefreshGit: true, FlashMsg: "Comparing against HEAD"}
+	}
+	return KeyResult{RefreshGit: true, FlashMsg: "Comparing against " + m.baseRef}
+}
+
+// describePaths names a single path, or counts several.
+func describePaths(paths []string) string {
+	if len(paths) == 1 {
+		return paths[0]
+	}
+	return fmt.Sprintf("%d files", len(paths))
+}
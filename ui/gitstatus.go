@@ -1,15 +1,356 @@
 package ui
 
-// gitFileStatus represents the git state of a file
-type gitFileStatus int
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/almonk/bontree/tree"
+)
+
+// gitChange is the kind of change recorded in one porcelain status column.
+// Higher values take priority when summarising a file or directory.
+type gitChange int
 
 const (
-	gitUnchanged  gitFileStatus = iota
-	gitModified                         // working tree modified
-	gitAdded                            // staged / new tracked file
-	gitDeleted                          // deleted
-	gitUntracked                        // untracked (?)
-	gitIgnored                          // ignored (!)
+	gitUnchanged gitChange = iota
+	gitModified            // modified (also renamed, copied, type-changed, unmerged)
+	gitAdded               // new tracked file
+	gitDeleted             // deleted
+	gitUntracked           // untracked (?)
+	gitIgnored             // ignored (!)
 )
 
+// gitFileStatus is the git state of a file, keeping the index (staged) and
+// worktree (unstaged) columns of `git status --porcelain` separate. When
+// comparing against a base ref, base holds the file's change since that ref,
+// which also covers changes that have already been committed.
+type gitFileStatus struct {
+	index    gitChange
+	worktree gitChange
+	base     gitChange
+}
+
+// lineCount is the number of lines added and removed in a file (or, for a
+// directory, in every file beneath it).
+type lineCount struct {
+	added   int
+	removed int
+}
+
+// maxCountedFileSize is the largest untracked file whose lines are counted.
+const maxCountedFileSize = 1 << 20
+
+// lineCache remembers the line counts of untracked files by size and
+// modification time, so a refresh only reads the files that changed. A nil
+// lineCache reads every file.
+type lineCache struct {
+	mu    sync.Mutex
+	files map[string]cachedLines // absolute path -> count
+}
+
+type cachedLines struct {
+	modTime time.Time
+	size    int64
+	lines   int
+	ok      bool // the file was small enough and not binary
+}
+
+// count returns the number of lines in each of files (relative to dir)
+// that can be counted. Files no longer asked for are forgotten.
+func (c *lineCache) count(dir string, files []string) map[string]int {
+	var old map[string]cachedLines
+	if c != nil {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		old = c.files
+	}
+	next := make(map[string]cachedLines, len(files))
+	result := make(map[string]int)
+	for _, file := range files {
+		abs := filepath.Join(dir, file)
+		info, err := os.Stat(abs)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		entry, hit := old[abs]
+		if !hit || !entry.modTime.Equal(info.ModTime()) || entry.size != info.Size() {
+			entry = cachedLines{modTime: info.ModTime(), size: info.Size()}
+			entry.lines, entry.ok = countLines(abs, info.Size())
+		}
+		next[abs] = entry
+		if entry.ok {
+			result[file] = entry.lines
+		}
+	}
+	if c != nil {
+		c.files = next
+	}
+	return result
+}
+
+// countLines counts the lines of the text file at abs. It reports false
+// for binary files and files larger than maxCountedFileSize.
+func countLines(abs string, size int64) (int, bool) {
+	if size > maxCountedFileSize {
+		return 0, false
+	}
+	data, err := os.ReadFile(abs)
+	if err != nil || bytes.IndexByte(data, 0) >= 0 {
+		return 0, false
+	}
+	n := bytes.Count(data, []byte("\n"))
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		n++
+	}
+	return n, true
+}
+
+// parseGitChange maps a porcelain status letter to a gitChange.
+func parseGitChange(c byte) gitChange {
+	switch c {
+	case ' ':
+		return gitUnchanged
+	case 'A':
+		return gitAdded
+	case 'D':
+		return gitDeleted
+	case '?':
+		return gitUntracked
+	case '!':
+		return gitIgnored
+	}
+	return gitModified
+}
+
+// parsePorcelain parses `git status --porcelain` output, keeping the files
+// under prefix (e.g. "sub/dir/") keyed by their path relative to it.
+// Untracked and ignored files only have a worktree change: nothing about
+// them is staged.
+func parsePorcelain(out, prefix string) map[string]gitFileStatus {
+	result := make(map[string]gitFileStatus)
+	for _, line := range strings.Split(strings.TrimRight(out, "\n"), "\n") {
+		if len(line) < 4 {
+			continue
+		}
+		x, y := line[0], line[1]
+		file := strings.TrimSpace(line[3:])
+		// Handle renames: "R  old -> new"
+		if idx := strings.Index(file, " -> "); idx >= 0 {
+			file = file[idx+4:]
+		}
+
+		// Untracked and ignored directories are listed with a trailing slash
+		file = strings.TrimSuffix(file, "/")
+		if !strings.HasPrefix(file, prefix) {
+			continue
+		}
+		file = file[len(prefix):]
+		status := gitFileStatus{index: parseGitChange(x), worktree: parseGitChange(y)}
+		if status.worktree == gitUntracked || status.worktree == gitIgnored {
+			status.index = gitUnchanged
+		}
+		result[file] = status
+	}
+	return result
+}
+
+// letter returns the porcelain-style letter for the change.
+func (c gitChange) letter() string {
+	switch c {
+	case gitModified:
+		return "M"
+	case gitAdded:
+		return "A"
+	case gitDeleted:
+		return "D"
+	case gitUntracked:
+		return "?"
+	case gitIgnored:
+		return "!"
+	}
+	return " "
+}
+
+// name returns the change as a lowercase word, e.g. "modified", or "" for
+// gitUnchanged.
+func (c gitChange) name() string {
+	switch c {
+	case gitModified:
+		return "modified"
+	case gitAdded:
+		return "added"
+	case gitDeleted:
+		return "deleted"
+	case gitUntracked:
+		return "untracked"
+	case gitIgnored:
+		return "ignored"
+	}
+	return ""
+}
+
+// summary collapses the columns into the single change used for colouring.
+func (s gitFileStatus) summary() gitChange {
+	return max(s.index, s.worktree, s.base)
+}
+
+// committed reports whether the file only differs from the base ref by
+// changes that have already been committed.
+func (s gitFileStatus) committed() bool {
+	return s.base != gitUnchanged && s.index == gitUnchanged && s.worktree == gitUnchanged
+}
+
+// merge returns s combined with other, keeping the highest-priority change
+// in each column. Directories use this to summarise their children.
+func (s gitFileStatus) merge(other gitFileStatus) gitFileStatus {
+	return gitFileStatus{
+		index:    max(s.index, other.index),
+		worktree: max(s.worktree, other.worktree),
+		base:     max(s.base, other.base),
+	}
+}
+
+// hasDiff reports whether a file with this status differs from HEAD.
+func (s gitFileStatus) hasDiff() bool {
+	switch s.summary() {
+	case gitModified, gitAdded, gitDeleted:
+		return true
+	}
+	return false
+}
+
+// staged returns the status after `git add -A` of the file.
+func (s gitFileStatus) staged() gitFileStatus {
+	switch s.worktree {
+	case gitUntracked:
+		return gitFileStatus{index: gitAdded, base: s.base}
+	case gitDeleted:
+		return gitFileStatus{index: gitDeleted, base: s.base}
+	case gitModified:
+		if s.index == gitUnchanged {
+			return gitFileStatus{index: gitModified, base: s.base}
+		}
+		return gitFileStatus{index: s.index, base: s.base}
+	}
+	return s
+}
+
+// unstaged returns the status after `git restore --staged` of the file.
+func (s gitFileStatus) unstaged() gitFileStatus {
+	switch s.index {
+	case gitAdded:
+		return gitFileStatus{worktree: gitUntracked, base: s.base}
+	case gitDeleted:
+		return gitFileStatus{worktree: gitDeleted, base: s.base}
+	case gitModified:
+		if s.worktree == gitUnchanged {
+			return gitFileStatus{worktree: gitModified, base: s.base}
+		}
+		return gitFileStatus{worktree: s.worktree, base: s.base}
+	}
+	return s
+}
+
+// discarded returns the status after `git restore` of a tracked file.
+func (s gitFileStatus) discarded() gitFileStatus {
+	switch s.worktree {
+	case gitModified, gitDeleted:
+		return gitFileStatus{index: s.index, base: s.base}
+	}
+	return s
+}
+
+// propagateGitStatus merges every file's status into its parent
+// directories, so a directory shows what's staged/unstaged beneath it.
+// Ignored files are skipped so they don't dim their parent directories.
+func propagateGitStatus(files map[string]gitFileStatus) {
+	for file, status := range files {
+		if status.summary() == gitIgnored {
+			continue
+		}
+		for dir := parentDir(file); dir != ""; dir = parentDir(dir) {
+			files[dir] = files[dir].merge(status)
+		}
+	}
+}
+
+// propagateLineCounts adds every file's line counts to its parent
+// directories.
+func propagateLineCounts(counts map[string]lineCount) {
+	files := make([]string, 0, len(counts))
+	for file := range counts {
+		files = append(files, file)
+	}
+	for _, file := range files {
+		c := counts[file]
+		for dir := parentDir(file); dir != ""; dir = parentDir(dir) {
+			d := counts[dir]
+			d.added += c.added
+			d.removed += c.removed
+			counts[dir] = d
+		}
+	}
+}
+
+// parseNumstat parses `git diff --numstat` output. Binary files, listed
+// as "-", are skipped.
+func parseNumstat(out string) map[string]lineCount {
+	counts := make(map[string]lineCount)
+	for _, line := range strings.Split(strings.TrimRight(out, "\n"), "\n") {
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		added, err1 := strconv.Atoi(fields[0])
+		removed, err2 := strconv.Atoi(fields[1])
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		counts[fields[2]] = lineCount{added: added, removed: removed}
+	}
+	return counts
+}
+
+// gitDirEntries returns the entries that were filled in by
+// propagateGitStatus, i.e. every ancestor directory of another entry.
+func gitDirEntries(files map[string]gitFileStatus) map[string]bool {
+	dirs := make(map[string]bool)
+	for file := range files {
+		for dir := parentDir(file); dir != "" && !dirs[dir]; dir = parentDir(dir) {
+			dirs[dir] = true
+		}
+	}
+	return dirs
+}
+
+func parentDir(path string) string {
+	if i := strings.LastIndexByte(path, '/'); i > 0 {
+		return path[:i]
+	}
+	return ""
+}
+
+// lineCountOf returns the lines added/removed recorded for node, if any.
+func (m Model) lineCountOf(node *tree.Node) lineCount {
+	return m.gitLines[strings.TrimPrefix(node.Path, "./")]
+}
+
+// gitStatusOf returns the git status recorded for node, if any.
+func (m Model) gitStatusOf(node *tree.Node) gitFileStatus {
+	return m.gitFiles[strings.TrimPrefix(node.Path, "./")]
+}
+
 type clearFlashMsg struct{}
+
+// firstLine returns s up to the first newline.
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
@@ -0,0 +1,97 @@
+package ui
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParsePorcelain(t *testing.T) {
+	out := "M  sub/staged.go\n" +
+		" M sub/edited.go\n" +
+		"MM sub/both.go\n" +
+		"R  sub/old.go -> sub/new.go\n" +
+		"?? sub/new.txt\n" +
+		"?? sub/fresh/\n" +
+		"!! sub/build/\n" +
+		"M  other/outside.go\n"
+	got := parsePorcelain(out, "sub/")
+	want := map[string]gitFileStatus{
+		"staged.go": {index: gitModified},
+		"edited.go": {worktree: gitModified},
+		"both.go":   {index: gitModified, worktree: gitModified},
+		"new.go":    {index: gitModified},
+		"new.txt":   {worktree: gitUntracked},
+		"fresh":     {worktree: gitUntracked},
+		"build":     {worktree: gitIgnored},
+	}
+	if len(got) != len(want) {
+		t.Errorf("parsePorcelain = %v, want %v", got, want)
+	}
+	for file, status := range want {
+		if got[file] != status {
+			t.Errorf("%s: status = %+v, want %+v", file, got[file], status)
+		}
+	}
+}
+
+func TestPropagateGitStatus(t *testing.T) {
+	files := map[string]gitFileStatus{
+		"a/staged.go":    {index: gitAdded},
+		"a/new.txt":      {worktree: gitUntracked},
+		"b/c/edited.go":  {worktree: gitModified},
+		"b/c/out/bin":    {worktree: gitIgnored},
+		"b/c/removed.go": {index: gitDeleted},
+	}
+	propagateGitStatus(files)
+	for dir, want := range map[string]gitFileStatus{
+		// An untracked file doesn't hide what's staged next to it
+		"a":   {index: gitAdded, worktree: gitUntracked},
+		"b":   {index: gitDeleted, worktree: gitModified},
+		"b/c": {index: gitDeleted, worktree: gitModified},
+	} {
+		if files[dir] != want {
+			t.Errorf("%s: status = %+v, want %+v", dir, files[dir], want)
+		}
+	}
+	if _, ok := files["b/c/out"]; ok {
+		t.Error("ignored files shouldn't propagate")
+	}
+}
+
+func TestLineCache(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a.txt", "one\ntwo\n")
+	write("new/b.txt", "one\ntwo\nthree")
+	write("bin", "\x00\x01")
+
+	c := &lineCache{}
+	got := c.count(dir, []string{"a.txt", "new/b.txt", "bin"})
+	if len(got) != 2 || got["a.txt"] != 2 || got["new/b.txt"] != 3 {
+		t.Errorf("count = %v, want a.txt:2 new/b.txt:3", got)
+	}
+
+	// A changed file is read again; one that's gone is forgotten
+	write("a.txt", "one\n")
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(filepath.Join(dir, "a.txt"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	got = c.count(dir, []string{"a.txt"})
+	if got["a.txt"] != 1 {
+		t.Errorf("count after edit = %v, want a.txt:1", got)
+	}
+	if len(c.files) != 1 {
+		t.Errorf("cache holds %d files, want 1", len(c.files))
+	}
+}
@@ -0,0 +1,340 @@
+package ui
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/almonk/bontree/config"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+const (
+	// grepMaxResults limits how many matching lines a content search finds.
+	grepMaxResults = 1000
+	// grepMaxFileSize is the largest file searched; bigger ones are usually
+	// generated or data.
+	grepMaxFileSize = 1 << 20
+	// grepMaxLineBytes limits how much of a matching line is kept.
+	grepMaxLineBytes = 512
+)
+
+// GrepSearch is a content search for the caller to run in the background.
+type GrepSearch struct {
+	Pattern *regexp.Regexp
+	Gen     int // tells this search's results apart from older ones
+}
+
+// grepMatch is a line that matched a content search.
+type grepMatch struct {
+	path       string // tree path of the file
+	line       int    // 1-based line number
+	text       string // the line, without its indentation
+	start, end int    // byte offsets of the first match in text
+}
+
+// grepBatch is a batch of results from a running content search.
+type grepBatch struct {
+	gen     int
+	matches []grepMatch
+	done    bool // the search finished
+	limited bool // the search stopped at grepMaxResults
+}
+
+// grepPane is the content search, shown in place of the tree until closed.
+// Every edit to the query cancels the running search and starts another.
+type grepPane struct {
+	query   string
+	err     error  // the query isn't a valid regexp
+	gen     int    // the running search's number, from Model.greps
+	cancel  func() // stops the running search
+	running bool
+	matches []grepMatch
+	files   int // files with a match
+	limited bool
+	cursor  int
+	scroll  int
+}
+
+// grepPattern compiles a content search query. Queries are literal text,
+// or a regexp after "re:"; either way they ignore case unless they contain
+// an upper-case letter.
+func grepPattern(query string) (*regexp.Regexp, error) {
+	expr, isRegexp := strings.CutPrefix(query, "re:")
+	flags := "(?m)"
+	if strings.IndexFunc(expr, unicode.IsUpper) < 0 {
+		flags = "(?mi)"
+	}
+	if !isRegexp {
+		expr = regexp.QuoteMeta(expr)
+	}
+	re, err := regexp.Compile(flags + expr)
+	var syntaxErr *syntax.Error
+	if errors.As(err, &syntaxErr) {
+		// Show the error as typed, without the flags
+		syntaxErr.Expr = strings.TrimPrefix(syntaxErr.Expr, flags)
+	}
+	return re, err
+}
+
+// grepFile returns up to limit lines of the file at abs that match re.
+// Binary files and files over grepMaxFileSize are skipped.
+func grepFile(abs, path string, re *regexp.Regexp, limit int) []grepMatch {
+	f, err := os.Open(abs)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err != nil || !info.Mode().IsRegular() || info.Size() > grepMaxFileSize {
+		return nil
+	}
+	data, err := io.ReadAll(f)
+	if err != nil || bytes.IndexByte(data[:min(len(data), previewSniffBytes)], 0) >= 0 || !re.Match(data) {
+		return nil
+	}
+
+	var matches []grepMatch
+	for line := 1; len(data) > 0 && len(matches) < limit; line++ {
+		var text []byte
+		text, data, _ = bytes.Cut(data, []byte("\n"))
+		text = bytes.TrimRight(text, "\r")
+		loc := re.FindIndex(text)
+		if loc == nil {
+			continue
+		}
+		indent := len(text) - len(bytes.TrimLeft(text, " \t"))
+		text = text[indent:max(min(len(text), loc[1]+grepMaxLineBytes), indent)]
+		matches = append(matches, grepMatch{
+			path:  path,
+			line:  line,
+			text:  string(text),
+			start: max(loc[0]-indent, 0),
+			end:   max(loc[1]-indent, 0),
+		})
+	}
+	return matches
+}
+
+// startGrep opens the content search pane.
+func (m *Model) startGrep() {
+	if m.tree == nil {
+		return
+	}
+	m.grep = &grepPane{}
+}
+
+// closeGrep cancels the running content search and closes the pane.
+func (m *Model) closeGrep() {
+	m.grep.stop()
+	m.grep = nil
+}
+
+// stop cancels the running search, if any.
+func (g *grepPane) stop() {
+	if g.cancel != nil {
+		g.cancel()
+		g.cancel = nil
+	}
+	g.running = false
+}
+
+// searchContents cancels the running search and starts one for the query.
+func (m *Model) searchContents() KeyResult {
+	g := m.grep
+	g.stop()
+	// Numbered across panes, so a search from a closed one can't match
+	m.greps++
+	g.gen = m.greps
+	g.err = nil
+	g.matches, g.files, g.limited = nil, 0, false
+	g.cursor, g.scroll = 0, 0
+	if g.query == "" || g.query == "re:" {
+		return KeyResult{}
+	}
+	re, err := grepPattern(g.query)
+	if err != nil {
+		g.err = err
+		return KeyResult{}
+	}
+	g.running = true
+	return KeyResult{Grep: &GrepSearch{Pattern: re, Gen: g.gen}}
+}
+
+// addGrepResults adds a batch of results to the pane. It reports false if
+// the batch is from a search that was cancelled or replaced.
+func (m *Model) addGrepResults(b grepBatch) bool {
+	g := m.grep
+	if g == nil || b.gen != g.gen || !g.running {
+		return false
+	}
+	for _, match := range b.matches {
+		// Each file's matches arrive together
+		if n := len(g.matches); n == 0 || g.matches[n-1].path != match.path {
+			g.files++
+		}
+		g.matches = append(g.matches, match)
+	}
+	g.limited = b.limited
+	if b.done {
+		g.running = false
+		g.cancel = nil
+	}
+	return true
+}
+
+// handleGrepKey edits the content search query, moves between results or
+// opens the selected one in $EDITOR.
+func (m *Model) handleGrepKey(key string, isRune bool) KeyResult {
+	g := m.grep
+	if isRune {
+		g.query += key
+		return m.searchContents()
+	}
+
+	page := max(m.grepHeight()/2, 1)
+	switch action := m.cfg.ActionFor(key); {
+	case key == "esc" || action == config.ActionSearchCancel:
+		m.closeGrep()
+
+	case key == "enter" || action == config.ActionSearchConfirm:
+		if len(g.matches) > 0 {
+			match := g.matches[g.cursor]
+			return KeyResult{OpenEditor: filepath.Join(m.root.AbsPath, match.path), EditorLine: match.line}
+		}
+
+	case key == "backspace" || action == config.ActionSearchBackspace:
+		if len(g.query) > 0 {
+			_, size := utf8.DecodeLastRuneInString(g.query)
+			g.query = g.query[:len(g.query)-size]
+			return m.searchContents()
+		}
+
+	case action == config.ActionQuit:
+		m.closeGrep()
+		return KeyResult{Quit: true}
+
+	case action == config.ActionMoveDown || key == "down":
+		m.moveGrepCursor(1)
+	case action == config.ActionMoveUp || key == "up":
+		m.moveGrepCursor(-1)
+	case action == config.ActionHalfPageDown:
+		m.moveGrepCursor(page)
+	case action == config.ActionHalfPageUp:
+		m.moveGrepCursor(-page)
+	}
+	return KeyResult{}
+}
+
+// grepHeight is the number of results that fit above the query and status bar.
+func (m Model) grepHeight() int {
+	return max(m.height-2, 1)
+}
+
+// moveGrepCursor moves the selected result by delta, scrolling to keep it
+// in view.
+func (m *Model) moveGrepCursor(delta int) {
+	g := m.grep
+	if g == nil {
+		return
+	}
+	g.cursor = max(min(g.cursor+delta, len(g.matches)-1), 0)
+	h := m.grepHeight()
+	if g.cursor < g.scroll {
+		g.scroll = g.cursor
+	} else if g.cursor >= g.scroll+h {
+		g.scroll = g.cursor - h + 1
+	}
+}
+
+// summary describes the search's progress for the status bar.
+func (g *grepPane) summary() string {
+	switch {
+	case g.err != nil:
+		return "bad regexp"
+	case g.query == "":
+		return ""
+	}
+	s := fmt.Sprintf("%d matches in %d files", len(g.matches), g.files)
+	switch {
+	case len(g.matches) == 1:
+		s = "1 match"
+	case g.files == 1:
+		s = fmt.Sprintf("%d matches in 1 file", len(g.matches))
+	}
+	switch {
+	case g.running:
+		s += " · searching…"
+	case g.limited:
+		s += " · stopped at the limit"
+	}
+	return s
+}
+
+// grepView renders the content search results, the query and the status bar.
+func (m Model) grepView() string {
+	g := m.grep
+	var b strings.Builder
+	for row := 0; row < m.grepHeight(); row++ {
+		if row > 0 {
+			b.WriteString("\n")
+		}
+		if i := g.scroll + row; i < len(g.matches) {
+			b.WriteString(m.renderGrepMatch(g.matches[i], i == g.cursor, m.width))
+			continue
+		}
+		if row == 0 {
+			hint := ""
+			switch {
+			case g.err != nil:
+				hint = " ✗ " + g.err.Error()
+			case g.query == "":
+				hint = " Type to search file contents (re: for a regexp)"
+			case !g.running:
+				hint = " No matches"
+			}
+			b.WriteString(lipgloss.NewStyle().Foreground(colorComment).Render(ansi.Truncate(hint, m.width, "…")))
+		}
+	}
+	b.WriteString("\n")
+	b.WriteString(m.renderInputLine("grep", g.query))
+	b.WriteString("\n")
+	b.WriteString(m.renderStatusBar())
+	return b.String()
+}
+
+// renderGrepMatch renders a result as "path:line: text", highlighting the
+// match and keeping it in view on long lines.
+func (m Model) renderGrepMatch(match grepMatch, selected bool, width int) string {
+	base, pathStyle, highlight := fileStyle, flatPathStyle, matchHighlightStyle
+	if selected {
+		base, pathStyle, highlight = selectedStyle, flatPathSelectedStyle, matchHighlightSelectedStyle
+	}
+	loc := fmt.Sprintf("%s:%d: ", filepath.ToSlash(match.path), match.line)
+	before := sanitizePreviewLine(match.text[:match.start])
+	hit := sanitizePreviewLine(match.text[match.start:match.end])
+	after := sanitizePreviewLine(match.text[match.end:])
+
+	room := width - 1 - lipgloss.Width(loc)
+	if w := lipgloss.Width(before); w > room/3 && w+lipgloss.Width(hit) > room {
+		before = ansi.TruncateLeft(before, w-room/3, "…")
+	}
+	line := base.Render(" ") + pathStyle.Render(loc) + base.Render(before) + highlight.Render(hit) + base.Render(after)
+	line = ansi.Truncate(line, width, "…")
+	if !selected {
+		return line
+	}
+	if w := lipgloss.Width(line); w < width {
+		line += selectedStyle.Render(strings.Repeat(" ", width-w))
+	}
+	// Keep the selection background continuous, as in renderNode
+	return strings.ReplaceAll(line, "\x1b[0m", "") + "\x1b[0m"
+}
@@ -0,0 +1,86 @@
+//go:build !js
+
+package ui
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	"github.com/almonk/bontree/tree"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// grepBatchInterval is how often a running content search sends the
+// results it has found so far.
+const grepBatchInterval = 50 * time.Millisecond
+
+// grepResultsMsg carries a batch of results from a content search.
+type grepResultsMsg struct {
+	job *grepJob
+	grepBatch
+}
+
+// grepJob searches file contents in a goroutine, sending results in batches.
+type grepJob struct {
+	results chan grepResultsMsg
+}
+
+// startGrep searches the files t shows for s in the background, until it
+// finishes or ctx is cancelled.
+func startGrep(ctx context.Context, t *tree.Tree, root string, s GrepSearch) tea.Cmd {
+	job := &grepJob{results: make(chan grepResultsMsg)}
+	go job.run(ctx, t, root, s)
+	return job.wait()
+}
+
+// wait returns a command that blocks until the job sends its next batch.
+// Handlers call it again until the last one; once the job is cancelled it
+// returns no message.
+func (j *grepJob) wait() tea.Cmd {
+	return func() tea.Msg {
+		msg, ok := <-j.results
+		if !ok {
+			return nil
+		}
+		return msg
+	}
+}
+
+func (j *grepJob) run(ctx context.Context, t *tree.Tree, root string, s GrepSearch) {
+	defer close(j.results)
+	batch := grepBatch{gen: s.Gen}
+	found := 0
+	last := time.Now()
+	send := func() bool {
+		select {
+		case j.results <- grepResultsMsg{job: j, grepBatch: batch}:
+			batch.matches = nil
+			last = time.Now()
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	t.Walk(func(path string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		matches := grepFile(filepath.Join(root, path), path, s.Pattern, grepMaxResults-found)
+		found += len(matches)
+		batch.matches = append(batch.matches, matches...)
+		if found >= grepMaxResults {
+			batch.limited = true
+			return filepath.SkipAll
+		}
+		if len(batch.matches) > 0 && time.Since(last) >= grepBatchInterval && !send() {
+			return ctx.Err()
+		}
+		return nil
+	})
+	if ctx.Err() == nil {
+		batch.done = true
+		send()
+	}
+}
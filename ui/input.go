@@ -0,0 +1,84 @@
+package ui
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// textInput is a single-line prompt shown above the status bar, rendered
+// like the search input. It is used for anything that needs typed text.
+type textInput struct {
+	prompt   string // short label shown before the value
+	value    string
+	onSubmit func(m *Model, value string) KeyResult
+}
+
+// startInput opens a text input with an initial value.
+func (m *Model) startInput(prompt, value string, onSubmit func(m *Model, value string) KeyResult) {
+	m.input = &textInput{prompt: prompt, value: value, onSubmit: onSubmit}
+	m.ensureVisible()
+}
+
+// handleInputKey edits or submits the open text input.
+func (m *Model) handleInputKey(key string, isRune bool) KeyResult {
+	in := m.input
+	if isRune {
+		in.value += key
+		return KeyResult{}
+	}
+	switch key {
+	case "esc":
+		m.input = nil
+	case "enter":
+		m.input = nil
+		return in.onSubmit(m, in.value)
+	case "backspace":
+		if len(in.value) > 0 {
+			_, size := utf8.DecodeLastRuneInString(in.value)
+			in.value = in.value[:len(in.value)-size]
+		}
+	case "ctrl+u":
+		in.value = ""
+	case "ctrl+c":
+		m.input = nil
+	}
+	return KeyResult{}
+}
+
+// confirmPrompt is a question shown in the status bar, answered with a
+// single key.
+type confirmPrompt struct {
+	msg     string
+	answers map[string]func(m *Model) KeyResult // any other key cancels
+}
+
+// startConfirm asks msg as a yes/no question, calling onYes if confirmed.
+func (m *Model) startConfirm(msg string, onYes func(m *Model) KeyResult) {
+	m.startChoice(msg+"? (y/n)", map[string]func(m *Model) KeyResult{"y": onYes, "Y": onYes})
+}
+
+// startChoice asks msg, calling the answer for the key pressed.
+func (m *Model) startChoice(msg string, answers map[string]func(m *Model) KeyResult) {
+	m.confirm = &confirmPrompt{msg: msg, answers: answers}
+}
+
+// handleConfirmKey answers the pending confirmation prompt.
+func (m *Model) handleConfirmKey(key string) KeyResult {
+	prompt := m.confirm
+	m.confirm = nil
+	if answer, ok := prompt.answers[key]; ok {
+		return answer(m)
+	}
+	return KeyResult{FlashMsg: "Cancelled"}
+}
+
+// renderInputLine renders a prompt and value as a full-width input line.
+func (m Model) renderInputLine(prompt, value string) string {
+	line := searchPromptStyle.Render(prompt) + searchInputStyle.Render(value+"█")
+	if w := lipgloss.Width(line); w < m.width {
+		line += statusBase.Render(strings.Repeat(" ", m.width-w))
+	}
+	return line
+}
@@ -0,0 +1,297 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// changeKind is the kind of a journaled filesystem change.
+type changeKind int
+
+const (
+	changeMove    changeKind = iota // renamed or moved from → path
+	changeCreate                    // created path, and parents on the way to it
+	changeTrash                     // moved path to the trash
+	changeDiscard                   // discarded git changes, saved in backups first
+)
+
+// fileChange is one reversible change bontree made to the filesystem. Paths
+// are absolute.
+type fileChange struct {
+	kind    changeKind
+	path    string   // where the change left the file: moved to, created, or trashed from
+	from    string   // changeMove: where it was moved from
+	parents []string // changeCreate, changeMove: directories created on the way, outermost first
+	trashed string   // changeTrash, or an undone changeCreate: where path is in the trash
+	op      GitOp    // changeDiscard
+	backups []backup // changeDiscard
+}
+
+// backup is a worktree file saved before a git discard.
+type backup struct {
+	path  string // absolute path in the worktree
+	saved string // copy of the file, or "" if it didn't exist
+}
+
+// undo reverses the change. Apart from the files a discard restores,
+// nothing is overwritten: a file that would be is an error. Created files
+// are moved to the trash rather than deleted, in case they were written to
+// since.
+func (c *fileChange) undo() error {
+	switch c.kind {
+	case changeMove:
+		if err := moveBack(c.path, c.from); err != nil {
+			return err
+		}
+		removeEmptyDirs(c.parents)
+		return nil
+	case changeCreate:
+		trashed, err := moveToTrash(c.path, nil)
+		if err != nil {
+			return err
+		}
+		c.trashed = trashed
+		removeEmptyDirs(c.parents)
+		return nil
+	case changeTrash:
+		return restoreFromTrash(c.trashed, c.path)
+	case changeDiscard:
+		for _, b := range c.backups {
+			if err := os.RemoveAll(b.path); err != nil {
+				return err
+			}
+			if b.saved == "" {
+				continue
+			}
+			if err := copyAll(b.saved, b.path, nil); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// redo makes the change again after it was undone. A discard is run by the
+// caller, since it needs git.
+func (c *fileChange) redo() error {
+	switch c.kind {
+	case changeMove:
+		return moveBack(c.from, c.path)
+	case changeCreate:
+		return restoreFromTrash(c.trashed, c.path)
+	case changeTrash:
+		trashed, err := moveToTrash(c.path, nil)
+		if err != nil {
+			return err
+		}
+		c.trashed = trashed
+	}
+	return nil
+}
+
+// touched returns the paths whose directories the change added entries to
+// or removed them from.
+func (c fileChange) touched() []string {
+	switch c.kind {
+	case changeMove:
+		return append([]string{c.from, c.path}, c.parents...)
+	case changeCreate:
+		return append([]string{c.path}, c.parents...)
+	case changeDiscard:
+		paths := make([]string, len(c.backups))
+		for i, b := range c.backups {
+			paths[i] = b.path
+		}
+		return paths
+	}
+	return []string{c.path}
+}
+
+// donePath returns where the change leaves a file to put the cursor on,
+// or "" if it removes one.
+func (c fileChange) donePath() string {
+	if c.kind == changeMove || c.kind == changeCreate {
+		return c.path
+	}
+	return ""
+}
+
+// undonePath returns where undoing the change leaves a file to put the
+// cursor on, or "" if it removes one.
+func (c fileChange) undonePath() string {
+	switch c.kind {
+	case changeMove:
+		return c.from
+	case changeTrash:
+		return c.path
+	}
+	return ""
+}
+
+// removeEmptyDirs removes the directories bontree created, innermost
+// first, as long as they are still empty.
+func removeEmptyDirs(dirs []string) {
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if os.Remove(dirs[i]) != nil {
+			break
+		}
+	}
+}
+
+// moveBack moves src to dest, creating dest's directory if it's gone, but
+// refuses to replace anything already at dest.
+func moveBack(src, dest string) error {
+	if _, err := os.Lstat(dest); err == nil {
+		return fmt.Errorf("%s already exists", filepath.Base(dest))
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+	return moveFile(src, dest, nil)
+}
+
+// journalEntry is one user action: a file operation on one or more paths.
+type journalEntry struct {
+	desc    string // e.g. "rename main.go"
+	changes []fileChange
+}
+
+// journal records the filesystem changes made this session so they can be
+// undone and redone. Files about to be discarded are saved in dir, which is
+// removed when bontree exits. A nil journal records nothing.
+type journal struct {
+	undo  []journalEntry
+	redo  []journalEntry
+	dir   string
+	saved int // number of files saved in dir
+}
+
+// record adds an entry for changes just made. It clears the redo stack,
+// since those changes may no longer apply.
+func (j *journal) record(desc string, changes ...fileChange) {
+	if j == nil || len(changes) == 0 {
+		return
+	}
+	j.undo = append(j.undo, journalEntry{desc: desc, changes: changes})
+	j.redo = nil
+}
+
+// backup saves copies of paths before they are discarded.
+func (j *journal) backup(paths []string) ([]backup, error) {
+	if j == nil {
+		return nil, nil
+	}
+	if j.dir == "" {
+		dir, err := os.MkdirTemp("", "bontree-undo-")
+		if err != nil {
+			return nil, err
+		}
+		j.dir = dir
+	}
+	backups := make([]backup, len(paths))
+	for i, path := range paths {
+		backups[i].path = path
+		if _, err := os.Lstat(path); os.IsNotExist(err) {
+			continue
+		}
+		j.saved++
+		saved := filepath.Join(j.dir, strconv.Itoa(j.saved))
+		if err := copyAll(path, saved, nil); err != nil {
+			return nil, err
+		}
+		backups[i].saved = saved
+	}
+	return backups, nil
+}
+
+// close removes the saved files.
+func (j *journal) close() {
+	if j != nil && j.dir != "" {
+		os.RemoveAll(j.dir)
+	}
+}
+
+// undo reverses the most recent entry and moves the cursor to where its
+// first path was.
+func (m *Model) undo() KeyResult {
+	if m.journal == nil || len(m.journal.undo) == 0 {
+		return KeyResult{FlashMsg: "Nothing to undo"}
+	}
+	j := m.journal
+	entry := j.undo[len(j.undo)-1]
+	j.undo = j.undo[:len(j.undo)-1]
+
+	var err error
+	for i := len(entry.changes) - 1; i >= 0; i-- {
+		if err = entry.changes[i].undo(); err != nil {
+			break
+		}
+	}
+	m.reloadTouched(entry.changes)
+	if err != nil {
+		// Partly undone, so it can't be redone (or undone again) reliably
+		return KeyResult{RefreshGit: true, FlashMsg: fmt.Sprintf("✗ Undo %s: %s", entry.desc, err)}
+	}
+	j.redo = append(j.redo, entry)
+
+	note := m.afterFileOp(m.treePath(entry.changes[0].undonePath()))
+	return KeyResult{RefreshGit: true, FlashMsg: "✓ Undid " + entry.desc + note}
+}
+
+// redo makes the most recently undone entry again.
+func (m *Model) redo() KeyResult {
+	if m.journal == nil || len(m.journal.redo) == 0 {
+		return KeyResult{FlashMsg: "Nothing to redo"}
+	}
+	j := m.journal
+	entry := j.redo[len(j.redo)-1]
+	j.redo = j.redo[:len(j.redo)-1]
+
+	result := KeyResult{RefreshGit: true}
+	var err error
+	for i := range entry.changes {
+		c := &entry.changes[i]
+		if c.kind == changeDiscard {
+			// The backups still hold what's discarded, since undo restored it
+			result = m.runGitOp(c.op)
+			continue
+		}
+		if err = c.redo(); err != nil {
+			break
+		}
+	}
+	m.reloadTouched(entry.changes)
+	if err != nil {
+		result.FlashMsg = fmt.Sprintf("✗ Redo %s: %s", entry.desc, err)
+		return result
+	}
+	j.undo = append(j.undo, entry)
+
+	result.FlashMsg = "✓ Redid " + entry.desc + m.afterFileOp(m.treePath(entry.changes[0].donePath()))
+	return result
+}
+
+// reloadTouched reloads the directories changes added entries to or
+// removed them from.
+func (m *Model) reloadTouched(changes []fileChange) {
+	for _, c := range changes {
+		for _, path := range c.touched() {
+			m.reloadAncestor(m.treePath(path))
+		}
+	}
+	m.pruneMarks()
+}
+
+// treePath returns the tree path of the absolute path abs ("" for "").
+func (m Model) treePath(abs string) string {
+	if abs == "" {
+		return ""
+	}
+	rel, err := filepath.Rel(m.root.AbsPath, abs)
+	if err != nil {
+		return ""
+	}
+	return rel
+}
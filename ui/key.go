@@ -6,15 +6,20 @@ import (
 	"unicode/utf8"
 
 	"github.com/almonk/bontree/config"
-	"github.com/almonk/bontree/tree"
 )
 
 // KeyResult holds the outcome of HandleKey for the caller to act on.
 type KeyResult struct {
 	Quit       bool
-	FlashMsg   string // non-empty = set flash message
-	CopyPath   string // non-empty = copy this path to clipboard
-	OpenEditor string // non-empty = open file at this path in $EDITOR
+	FlashMsg   string      // non-empty = set flash message
+	CopyPath   string      // non-empty = copy this path to clipboard
+	OpenEditor string      // non-empty = open file at this path in $EDITOR
+	EditorLine int         // with OpenEditor: open the file at this line (0 = the top)
+	Git        *GitOp      // non-nil = run this git operation
+	RefreshGit bool        // re-read git status (e.g. after the base ref changed)
+	Command    *CommandRun // non-nil = run this user command
+	Paste      *PasteOp    // non-nil = copy or move these files in the background
+	Grep       *GrepSearch // non-nil = search file contents in the background
 }
 
 // HandleKey processes a key event given as a string name (e.g. "j", "esc", "ctrl+f").
@@ -22,6 +27,12 @@ type KeyResult struct {
 // This is the single source of truth for keyboard input handling, used by both
 // the Bubble Tea TUI and the WASM bridge.
 func (m *Model) HandleKey(key string, isRune bool) KeyResult {
+	result := m.handleKey(key, isRune)
+	m.syncPreview()
+	return result
+}
+
+func (m *Model) handleKey(key string, isRune bool) KeyResult {
 	if m.showHelp {
 		action := m.cfg.ActionFor(key)
 		if action == config.ActionHelp || action == config.ActionQuit || key == "esc" {
@@ -33,6 +44,26 @@ func (m *Model) HandleKey(key string, isRune bool) KeyResult {
 		return KeyResult{}
 	}
 
+	if m.output != nil {
+		return m.handleOutputKey(key)
+	}
+
+	if m.grep != nil {
+		return m.handleGrepKey(key, isRune)
+	}
+
+	if m.confirm != nil {
+		return m.handleConfirmKey(key)
+	}
+
+	if m.input != nil {
+		return m.handleInputKey(key, isRune)
+	}
+
+	if m.copyMenu {
+		return m.handleCopyMenuKey(key)
+	}
+
 	if m.searching {
 		return m.handleSearchKey(key, isRune)
 	}
@@ -78,6 +109,10 @@ func (m *Model) handleSearchKey(key string, isRune bool) KeyResult {
 			m.flatNodes = m.searchNodes
 		}
 		m.clampCursor()
+		// Flat search doubles as a fuzzy finder: enter picks the selected result
+		if m.flatSearch && m.canPick() {
+			return m.pick()
+		}
 
 	case key == "backspace" || action == config.ActionSearchBackspace:
 		if len(m.searchQuery) > 0 {
@@ -108,16 +143,19 @@ func (m *Model) handleSearchKey(key string, isRune bool) KeyResult {
 func (m *Model) handleNormalKey(key string) KeyResult {
 	action := m.cfg.ActionFor(key)
 
+	if name, ok := action.CopyFormatName(); ok {
+		return m.copyFormatByName(name)
+	}
+	if name, ok := action.CommandName(); ok {
+		return m.runCommand(name)
+	}
+
 	switch action {
 	case config.ActionClearFilter:
-		if m.filtered {
-			m.filtered = false
-			m.flatSearch = false
-			m.searchQuery = ""
-			m.searchNodes = nil
-			m.searchMatchIndices = nil
-			m.searchPathIndices = nil
-			m.restoreExpandedState()
+		if m.visualAnchor != nil {
+			m.visualAnchor = nil
+		} else if m.filtered {
+			m.clearFilter()
 		}
 
 	case config.ActionQuit:
@@ -174,6 +212,9 @@ func (m *Model) handleNormalKey(key string) KeyResult {
 		}
 
 	case config.ActionToggle:
+		if m.canPick() {
+			return m.pick()
+		}
 		node := m.flatNodes[m.cursor]
 		if node.IsDir {
 			node.Toggle()
@@ -181,10 +222,33 @@ func (m *Model) handleNormalKey(key string) KeyResult {
 		}
 
 	case config.ActionCopyPath:
+		if len(m.marks) > 0 {
+			paths := m.targetPaths()
+			return KeyResult{
+				CopyPath: strings.Join(paths, m.cfg.CopySeparator),
+				FlashMsg: fmt.Sprintf("✓ Copied %d paths", len(paths)),
+			}
+		}
 		node := m.flatNodes[m.cursor]
 		relPath := strings.TrimPrefix(node.Path, "./")
 		return KeyResult{CopyPath: relPath, FlashMsg: fmt.Sprintf("✓ Copied path: %s", relPath)}
 
+	case config.ActionCopyMenu:
+		m.copyMenu = true
+		m.ensureVisible()
+
+	case config.ActionToggleMark:
+		return m.toggleMark()
+
+	case config.ActionMarkAll:
+		return m.markAll()
+
+	case config.ActionClearMarks:
+		return m.clearMarks()
+
+	case config.ActionVisualMark:
+		return m.toggleVisual()
+
 	case config.ActionExpandAll:
 		m.setExpandAll(m.root, true)
 		m.refreshFlatNodes()
@@ -198,8 +262,13 @@ func (m *Model) handleNormalKey(key string) KeyResult {
 
 	case config.ActionToggleHidden:
 		m.showHidden = !m.showHidden
-		tree.ShowHidden = m.showHidden
-		if root, err := tree.BuildTree(m.rootPath); err == nil {
+		if m.tree == nil {
+			break
+		}
+		opts := m.tree.Options()
+		opts.ShowHidden = m.showHidden
+		m.tree.SetOptions(opts)
+		if root, err := m.tree.Build(); err == nil {
 			m.root = root
 			m.refreshFlatNodes()
 			m.ensureVisible()
@@ -211,10 +280,80 @@ func (m *Model) handleNormalKey(key string) KeyResult {
 	case config.ActionFlatSearch:
 		m.startSearch(true)
 
+	case config.ActionGrep:
+		m.startGrep()
+
 	case config.ActionHelp:
 		m.showHelp = !m.showHelp
 
+	case config.ActionTogglePreview:
+		m.showPreview = !m.showPreview
+		m.preview = nil
+
+	case config.ActionToggleDiff:
+		if m.showPreview {
+			m.previewRaw = !m.previewRaw
+		} else {
+			m.showPreview = true
+			m.previewRaw = false
+		}
+		m.preview = nil
+
+	case config.ActionPreviewDown:
+		m.scrollPreview(m.viewportHeight() / 2)
+
+	case config.ActionPreviewUp:
+		m.scrollPreview(-m.viewportHeight() / 2)
+
+	case config.ActionSetBase:
+		m.startInput("base", m.baseRef, setBaseRef)
+
+	case config.ActionToggleChanged:
+		m.toggleChangedOnly()
+
+	case config.ActionGitStage:
+		return m.startGitOp(GitStage)
+
+	case config.ActionGitUnstage:
+		return m.startGitOp(GitUnstage)
+
+	case config.ActionGitDiscard:
+		return m.startGitOp(GitDiscard)
+
+	case config.ActionNewFile:
+		return m.startCreate(false)
+
+	case config.ActionNewDir:
+		return m.startCreate(true)
+
+	case config.ActionRename:
+		return m.startRename()
+
+	case config.ActionMove:
+		return m.startMove()
+
+	case config.ActionTrash:
+		return m.startTrash()
+
+	case config.ActionYank:
+		return m.yank(false)
+
+	case config.ActionCut:
+		return m.yank(true)
+
+	case config.ActionPaste:
+		return m.paste()
+
+	case config.ActionUndo:
+		return m.undo()
+
+	case config.ActionRedo:
+		return m.redo()
+
 	case config.ActionOpenEditor:
+		if m.canPick() {
+			return m.pick()
+		}
 		node := m.flatNodes[m.cursor]
 		if node.IsDir {
 			node.Toggle()
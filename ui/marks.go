@@ -0,0 +1,178 @@
+package ui
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/almonk/bontree/tree"
+)
+
+// markGlyph replaces the leading space of marked rows.
+const markGlyph = "▌"
+
+// visualRange returns the rows covered by the visual selection, from the
+// anchor to the cursor. ok is false when no selection is in progress or the
+// anchor is no longer visible.
+func (m Model) visualRange() (lo, hi int, ok bool) {
+	if m.visualAnchor == nil {
+		return 0, 0, false
+	}
+	for i, n := range m.flatNodes {
+		if n == m.visualAnchor {
+			lo, hi = i, m.cursor
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			return lo, hi, true
+		}
+	}
+	return 0, 0, false
+}
+
+// isMarked reports whether row i is marked or inside the visual selection.
+func (m Model) isMarked(i int) bool {
+	if m.marks[m.flatNodes[i].Path] {
+		return true
+	}
+	lo, hi, ok := m.visualRange()
+	return ok && i >= lo && i <= hi
+}
+
+// markable reports whether node can be marked. The root stands for the
+// whole tree, so it never is.
+func (m Model) markable(node *tree.Node) bool {
+	return node != m.root
+}
+
+// setMark marks or unmarks path.
+func (m *Model) setMark(path string, marked bool) {
+	if !marked {
+		delete(m.marks, path)
+		return
+	}
+	if m.marks == nil {
+		m.marks = make(map[string]bool)
+	}
+	m.marks[path] = true
+}
+
+// toggleMark marks or unmarks the cursor node and moves down, so a run of
+// files can be marked by pressing the key repeatedly. During a visual
+// selection it marks the selected rows instead.
+func (m *Model) toggleMark() KeyResult {
+	if m.visualAnchor != nil {
+		return m.commitVisual()
+	}
+	if len(m.flatNodes) == 0 {
+		return KeyResult{}
+	}
+	node := m.flatNodes[m.cursor]
+	if m.markable(node) {
+		m.setMark(node.Path, !m.marks[node.Path])
+	}
+	m.moveCursor(1)
+	return KeyResult{}
+}
+
+// markAll marks every search match, every changed file in the changed-files
+// view, or otherwise every visible row.
+func (m *Model) markAll() KeyResult {
+	count := 0
+	for _, node := range m.flatNodes {
+		if !m.markable(node) {
+			continue
+		}
+		if m.filtered || m.searching {
+			if _, ok := m.searchMatchIndices[node]; !ok {
+				continue
+			}
+		} else if m.changedOnly && (node.IsDir || !m.isChanged(node)) {
+			continue
+		}
+		m.setMark(node.Path, true)
+		count++
+	}
+	if count == 0 {
+		return KeyResult{FlashMsg: "Nothing to mark"}
+	}
+	return KeyResult{FlashMsg: fmt.Sprintf("Marked %d, %d total", count, len(m.marks))}
+}
+
+// clearMarks drops every mark and any visual selection.
+func (m *Model) clearMarks() KeyResult {
+	m.visualAnchor = nil
+	if len(m.marks) == 0 {
+		return KeyResult{}
+	}
+	m.marks = nil
+	return KeyResult{FlashMsg: "Cleared marks"}
+}
+
+// toggleVisual starts a visual selection at the cursor, or marks the rows
+// of the current one.
+func (m *Model) toggleVisual() KeyResult {
+	if m.visualAnchor != nil {
+		return m.commitVisual()
+	}
+	if len(m.flatNodes) > 0 {
+		m.visualAnchor = m.flatNodes[m.cursor]
+	}
+	return KeyResult{}
+}
+
+// commitVisual marks every row in the visual selection and ends it.
+func (m *Model) commitVisual() KeyResult {
+	lo, hi, ok := m.visualRange()
+	m.visualAnchor = nil
+	if !ok {
+		return KeyResult{}
+	}
+	for _, node := range m.flatNodes[lo : hi+1] {
+		if m.markable(node) {
+			m.setMark(node.Path, true)
+		}
+	}
+	return KeyResult{FlashMsg: fmt.Sprintf("%d marked", len(m.marks))}
+}
+
+// targetPaths returns the paths an action applies to: the marked paths in
+// sorted order, or the cursor node's path when nothing is marked.
+func (m Model) targetPaths() []string {
+	if len(m.marks) == 0 {
+		if len(m.flatNodes) == 0 {
+			return nil
+		}
+		return []string{m.flatNodes[m.cursor].Path}
+	}
+	paths := make([]string, 0, len(m.marks))
+	for path := range m.marks {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// pruneMarks forgets marks on paths that no longer exist in the tree. It
+// reads nothing from disk, so marks under a directory that isn't loaded
+// (e.g. one a search loaded and then dropped) are kept.
+func (m *Model) pruneMarks() {
+	for path := range m.marks {
+		if m.root.Find(path) == nil && !m.underUnloaded(path) {
+			delete(m.marks, path)
+		}
+	}
+}
+
+// underUnloaded reports whether the nearest ancestor of path in the tree is
+// a directory whose children haven't been loaded. The root, ".", always
+// ends the search.
+func (m *Model) underUnloaded(path string) bool {
+	dir := filepath.Dir(path)
+	node := m.root.Find(dir)
+	for node == nil {
+		dir = filepath.Dir(dir)
+		node = m.root.Find(dir)
+	}
+	return node.IsDir && !node.Loaded
+}
@@ -1,6 +1,8 @@
 package ui
 
 import (
+	"fmt"
+	"path/filepath"
 	"time"
 
 	"github.com/almonk/bontree/config"
@@ -12,19 +14,62 @@ import (
 // In WASM it is used directly via HandleKey/View.
 type Model struct {
 	root      *tree.Node
+	tree      *tree.Tree // loads root's directories (nil in the demo)
 	flatNodes []*tree.Node
 	cursor    int
 	width     int
 	height    int
 	rootPath  string
 	flashMsg  string
+	confirm   *confirmPrompt // pending yes/no question in the status bar
+	input     *textInput     // open text input, if any
+	copyMenu  bool           // the copy format menu is open
+	output    *commandOutput // output of a pane command, shown instead of the tree
+	runs      int            // pane commands started, to tell their results apart
+	grep      *grepPane      // content search, shown instead of the tree
+	greps     int            // content searches started, to tell their results apart
+	journal   *journal       // file changes that can be undone (nil in the demo)
+	register  *register      // yanked or cut paths for the next paste
+	pasting   *pasteStatus   // progress of the running paste, if any
 	showHelp  bool
 	scrollOff int
 	gitBranch  string
 	gitFiles   map[string]gitFileStatus // relative path -> status
+	gitLines   map[string]lineCount     // relative path -> lines added/removed
+	lineCache  *lineCache               // line counts of untracked files (nil in the demo)
+	baseRef    string                   // compare against this ref instead of HEAD (empty = HEAD)
+	baseErr    string                   // last error comparing against baseRef
 	showHidden bool
 	cfg        *config.Config
 
+	// Preview pane
+	showPreview   bool
+	preview       *filePreview
+	previewScroll int
+	previewRaw    bool              // show file contents instead of the diff for changed files
+	demoFiles     map[string]string // file contents for the demo tree (nil = read from disk)
+	demoDiffs     map[string]string // diffs against HEAD for the demo tree
+
+	// Changed-files view
+	changedOnly          bool
+	changedSavedExpanded map[*tree.Node]bool // expanded state before entering the view
+
+	// Marks (relative paths) and the visual selection anchor
+	marks        map[string]bool
+	visualAnchor *tree.Node
+
+	// Picker mode (--pick)
+	pickMode bool
+	picked   []string // chosen paths, set when the picker confirms
+
+	// Control socket (nil when not listening)
+	control *controlServer
+
+	// Filesystem watching (nil when unavailable; git is then polled)
+	watcher    *fsWatcher
+	gitPending bool // a git status fetch is in flight
+	gitStale   bool // another change arrived while the fetch was running
+
 	// Mouse
 	lastClickTime time.Time
 	lastClickRow  int
@@ -50,27 +95,81 @@ func New(rootPath string, cfg *config.Config) (Model, error) {
 		cfg = config.DefaultConfig()
 	}
 
-	tree.ShowHidden = cfg.ShowHidden
-	tree.RefreshGitIgnored(rootPath)
-	root, err := tree.BuildTree(rootPath)
+	t, err := tree.New(rootPath, treeOptions(cfg))
 	if err != nil {
 		return Model{}, err
 	}
+	root, err := t.Build()
+	if err != nil {
+		return Model{}, err
+	}
+	if cfg.ExpandDepth > 0 {
+		// The root is always expanded, so depth 1 opens its subdirectories
+		expandToDepth(root, cfg.ExpandDepth+1)
+	}
 
-	return Model{
+	m := Model{
 		root:       root,
+		tree:       t,
+		journal:    &journal{},
+		lineCache:  &lineCache{},
 		flatNodes:  flattenTree(root),
 		rootPath:   rootPath,
 		showHidden: cfg.ShowHidden,
 		cfg:        cfg,
-	}, nil
+		baseRef:    cfg.BaseRef,
+	}
+
+	if cfg.Filter != "" {
+		m.setFilter(cfg.Filter, false)
+	}
+	if cfg.Select != "" {
+		hidden, err := m.revealNearest(cfg.Select)
+		if err != nil {
+			return Model{}, fmt.Errorf("--select: %w", err)
+		}
+		if hidden {
+			m.flashMsg = filepath.Base(cfg.Select) + " (hidden)"
+		}
+	}
+
+	// Start these last, so a bad --select doesn't leave them running
+	m.control, err = newControlServer(cfg.Socket)
+	if err != nil {
+		return Model{}, err
+	}
+	m.watcher = newFSWatcher(rootPath)
+	return m, nil
+}
+
+// treeOptions returns the tree options set by cfg.
+func treeOptions(cfg *config.Config) tree.Options {
+	return tree.Options{
+		ShowHidden:       cfg.ShowHidden,
+		RespectGitignore: cfg.RespectGitignore,
+		Exclude:          cfg.Exclude,
+		Include:          cfg.Include,
+	}
+}
+
+// expandToDepth expands every directory down to depth levels below node
+// (all of them when depth is 0).
+func expandToDepth(node *tree.Node, depth int) {
+	for _, child := range node.Children {
+		if !child.IsDir || (depth > 0 && child.Depth >= depth) {
+			continue
+		}
+		if child.Expand() == nil {
+			expandToDepth(child, depth)
+		}
+	}
 }
 
 // --- Helpers ---
 
 // refreshFlatNodes rebuilds the flat node list and clamps the cursor.
 func (m *Model) refreshFlatNodes() {
-	m.flatNodes = flattenTree(m.root)
+	m.flatNodes = m.visibleNodes()
 	m.clampCursor()
 }
 
@@ -107,6 +206,9 @@ func (m *Model) setExpandAll(node *tree.Node, expanded bool) {
 
 // refreshTree rebuilds the file tree from disk, preserving expanded state and cursor.
 func (m *Model) refreshTree() {
+	if m.tree == nil {
+		return
+	}
 	// Capture expanded paths and cursor path
 	expandedPaths := make(map[string]bool)
 	for _, n := range tree.FlattenAll(m.root) {
@@ -120,7 +222,7 @@ func (m *Model) refreshTree() {
 	}
 
 	// Rebuild
-	root, err := tree.BuildTree(m.rootPath)
+	root, err := m.tree.Build()
 	if err != nil {
 		return
 	}
@@ -137,17 +239,39 @@ func (m *Model) refreshTree() {
 		}
 	}
 	m.root.Expanded = true
+	m.visualAnchor = nil
+	m.pruneMarks()
 
 	if m.filtered && m.searchNodes != nil {
 		m.applySearchFilter()
 	} else {
 		m.refreshFlatNodes()
 	}
+	m.restoreCursorPath(cursorPath)
+}
+
+// refreshFlatNodesKeepCursor re-derives the visible rows after the tree was
+// patched in place, keeping the cursor on the same path where possible.
+func (m *Model) refreshFlatNodesKeepCursor() {
+	var cursorPath string
+	if m.cursor >= 0 && m.cursor < len(m.flatNodes) {
+		cursorPath = m.flatNodes[m.cursor].Path
+	}
+	scrollOff := m.scrollOff
+	if m.filtered && m.searchNodes != nil {
+		m.applySearchFilter()
+		m.scrollOff = scrollOff
+	} else {
+		m.refreshFlatNodes()
+	}
+	m.restoreCursorPath(cursorPath)
+}
 
-	// Restore cursor position
-	if cursorPath != "" {
+// restoreCursorPath moves the cursor to the row showing path, if visible.
+func (m *Model) restoreCursorPath(path string) {
+	if path != "" {
 		for i, n := range m.flatNodes {
-			if n.Path == cursorPath {
+			if n.Path == path {
 				m.cursor = i
 				break
 			}
@@ -161,8 +285,8 @@ func (m *Model) refreshTree() {
 
 func (m *Model) viewportHeight() int {
 	h := m.height - 1 // status bar
-	if m.searching {
-		h-- // search input
+	if m.searching || m.input != nil || m.copyMenu {
+		h-- // search, text input or copy menu
 	}
 	if h < 1 {
 		h = 1
@@ -200,6 +324,7 @@ func (m *Model) HasFlash() bool {
 
 // HandleClick processes a mouse click at the given row (0-indexed from viewport top).
 func (m *Model) HandleClick(row int, doubleClick bool) {
+	defer m.syncPreview()
 	if m.showHelp {
 		m.showHelp = false
 		return
@@ -223,6 +348,7 @@ func (m *Model) HandleClick(row int, doubleClick bool) {
 // HandleScroll processes a scroll event (dir: +1 = down, -1 = up).
 func (m *Model) HandleScroll(dir int) {
 	m.moveCursor(dir * 3)
+	m.syncPreview()
 }
 
 // --- Utility ---
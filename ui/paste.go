@@ -0,0 +1,137 @@
+//go:build !js
+
+package ui
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// pasteProgressInterval is how often a running paste reports progress.
+const pasteProgressInterval = 100 * time.Millisecond
+
+// pasteProgressMsg reports how much of a paste has been copied.
+type pasteProgressMsg struct {
+	job           *pasteJob
+	copied, total int64 // bytes
+}
+
+// pasteDoneMsg is sent when a paste finishes, with the changes it made for
+// the journal.
+type pasteDoneMsg struct {
+	op      PasteOp
+	changes []fileChange
+	err     error
+}
+
+// pasteJob runs a paste in a goroutine, reporting progress on a channel.
+type pasteJob struct {
+	progress chan pasteProgressMsg
+	done     chan pasteDoneMsg
+}
+
+// startPaste starts copying or moving op's files in the background.
+func startPaste(op PasteOp) tea.Cmd {
+	job := &pasteJob{
+		progress: make(chan pasteProgressMsg, 1),
+		done:     make(chan pasteDoneMsg, 1),
+	}
+	go job.run(op)
+	return job.wait()
+}
+
+// wait returns a command that blocks until the job reports progress or
+// finishes. Handlers call it again after each progress message.
+func (j *pasteJob) wait() tea.Cmd {
+	return func() tea.Msg {
+		select {
+		case msg := <-j.done:
+			return msg
+		case msg := <-j.progress:
+			return msg
+		}
+	}
+}
+
+func (j *pasteJob) run(op PasteOp) {
+	var copied, total int64
+	if !op.Cut && !op.Trash {
+		for _, item := range op.Items {
+			total += diskUsage(item.Src)
+		}
+	}
+	var last time.Time
+	report := func(n int64) {
+		copied += n
+		if time.Since(last) < pasteProgressInterval {
+			return
+		}
+		last = time.Now()
+		select {
+		case j.progress <- pasteProgressMsg{job: j, copied: copied, total: total}:
+		default: // the last report hasn't been read yet
+		}
+	}
+
+	var changes []fileChange
+	for _, item := range op.Items {
+		if err := pasteItem(op, item, report, &changes); err != nil {
+			j.done <- pasteDoneMsg{op: op, changes: changes, err: fmt.Errorf("%s: %w", filepath.Base(item.Src), err)}
+			return
+		}
+	}
+	j.done <- pasteDoneMsg{op: op, changes: changes}
+}
+
+// pasteItem copies, moves or trashes one item, appending what it did to
+// changes.
+func pasteItem(op PasteOp, item PasteItem, report func(int64), changes *[]fileChange) error {
+	if op.Trash {
+		trashed, err := moveToTrash(item.Src, report)
+		if err != nil {
+			return err
+		}
+		*changes = append(*changes, fileChange{kind: changeTrash, path: item.Src, trashed: trashed})
+		return nil
+	}
+	if item.Replace {
+		trashed, err := moveToTrash(item.Dest, nil)
+		if err != nil {
+			return err
+		}
+		*changes = append(*changes, fileChange{kind: changeTrash, path: item.Dest, trashed: trashed})
+	}
+	if op.Cut {
+		if err := moveFile(item.Src, item.Dest, nil); err != nil {
+			return err
+		}
+		*changes = append(*changes, fileChange{kind: changeMove, from: item.Src, path: item.Dest})
+		return nil
+	}
+	if err := copyAll(item.Src, item.Dest, report); err != nil {
+		// Don't leave half a copy behind
+		os.RemoveAll(item.Dest)
+		return err
+	}
+	*changes = append(*changes, fileChange{kind: changeCreate, path: item.Dest})
+	return nil
+}
+
+// diskUsage returns the total size of the regular files at or under path.
+func diskUsage(path string) int64 {
+	var size int64
+	filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
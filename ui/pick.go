@@ -0,0 +1,41 @@
+package ui
+
+import "path/filepath"
+
+// EnablePick turns on picker mode: confirming a file, or the marked set,
+// quits and records the selection for Picked.
+func (m *Model) EnablePick() {
+	m.pickMode = true
+}
+
+// Picked returns the absolute paths chosen in picker mode, or nil if the
+// picker was cancelled.
+func (m Model) Picked() []string {
+	if m.picked == nil {
+		return nil
+	}
+	absRoot, err := filepath.Abs(m.rootPath)
+	if err != nil {
+		absRoot = m.rootPath
+	}
+	paths := make([]string, len(m.picked))
+	for i, path := range m.picked {
+		paths[i] = filepath.Join(absRoot, filepath.FromSlash(path))
+	}
+	return paths
+}
+
+// canPick reports whether confirming the cursor row picks it: files always
+// do, directories only as part of a marked set (otherwise they toggle).
+func (m Model) canPick() bool {
+	if !m.pickMode || len(m.flatNodes) == 0 {
+		return false
+	}
+	return len(m.marks) > 0 || !m.flatNodes[m.cursor].IsDir
+}
+
+// pick records the marked paths (or the cursor path) and quits.
+func (m *Model) pick() KeyResult {
+	m.picked = m.targetPaths()
+	return KeyResult{Quit: true}
+}
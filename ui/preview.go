@@ -0,0 +1,355 @@
+package ui
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/almonk/bontree/tree"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+const (
+	// previewMaxBytes limits how much of a file is read for the preview.
+	previewMaxBytes = 512 * 1024
+	// previewSniffBytes is how much of the file is checked for NUL bytes
+	// when deciding whether it is binary (the same heuristic git uses).
+	previewSniffBytes = 8000
+	// previewMinWidth is the narrowest preview pane worth drawing.
+	previewMinWidth = 20
+	// previewTabWidth is the number of spaces a tab expands to.
+	previewTabWidth = 4
+)
+
+// filePreview is the loaded contents of the file under the cursor.
+type filePreview struct {
+	path      string
+	absPath   string // where the contents are read from ("" for the demo)
+	modTime   time.Time
+	size      int64
+	lines     []string
+	binary    bool
+	truncated bool // only the first previewMaxBytes were read
+	isDir     bool
+	entries   int           // number of children for directories
+	status    gitFileStatus // git status when the preview was loaded
+	diff      bool          // lines hold a unified diff against HEAD
+	added     int           // diff lines added
+	removed   int           // diff lines removed
+	err       error
+
+	// The diff of a changed file is fetched in the background; until it
+	// arrives (or if there is none) the preview holds the contents.
+	diffPending   bool
+	diffRequested bool
+
+	// The contents of a file on disk are read in the background as well.
+	// Clearing loadRequested once they have arrived reads the file again
+	// and reloads the preview if it changed.
+	loadPending   bool
+	loadRequested bool
+}
+
+// loadPreview returns the preview for node. Demo contents are filled in
+// right away; a file on disk is left pending for requestPreview to read.
+func (m *Model) loadPreview(node *tree.Node) *filePreview {
+	p := &filePreview{path: node.Path, status: m.gitStatusOf(node)}
+
+	if node.IsDir {
+		p.isDir = true
+		p.entries = len(node.Children)
+		if !node.Loaded && node.AbsPath != "" {
+			if entries, err := os.ReadDir(node.AbsPath); err == nil {
+				p.entries = len(entries)
+			}
+		}
+		return p
+	}
+
+	if !m.previewRaw && p.status.hasDiff() {
+		if m.demoFiles == nil {
+			p.diffPending = true
+		} else if p.setDiff(m.demoDiffs[node.Path]) {
+			return p
+		}
+	}
+
+	if m.demoFiles != nil {
+		content := m.demoFiles[node.Path]
+		p.size = int64(len(content))
+		p.setContent([]byte(content))
+		return p
+	}
+
+	p.absPath = node.AbsPath
+	p.loadPending = true
+	return p
+}
+
+// setDiff replaces the preview's lines with diff, the output of git diff.
+// It reports false, leaving p as it was, if diff is empty.
+func (p *filePreview) setDiff(diff string) bool {
+	if diff == "" {
+		return false
+	}
+
+	p.diff = true
+	p.binary, p.truncated = false, false
+	lines := strings.Split(strings.TrimSuffix(diff, "\n"), "\n")
+	// Drop the "diff --git"/"index"/"---"/"+++" preamble; the header line
+	// already says which file this is.
+	for i, line := range lines {
+		if strings.HasPrefix(line, "@@") || strings.HasPrefix(line, "Binary files") {
+			lines = lines[i:]
+			break
+		}
+	}
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "+"):
+			p.added++
+		case strings.HasPrefix(line, "-"):
+			p.removed++
+		}
+	}
+	p.lines = lines
+	return true
+}
+
+// finishLoad fills the preview with the contents read for path. If they
+// arrive for a preview that was already loaded, it is only reloaded when
+// the file changed since.
+func (m *Model) finishLoad(path string, modTime time.Time, size int64, data []byte, err error) {
+	p := m.preview
+	if p == nil || p.path != path || p.absPath == "" {
+		return
+	}
+	if !p.loadPending {
+		if (err != nil) == (p.err != nil) && modTime.Equal(p.modTime) && size == p.size {
+			return
+		}
+		p = &filePreview{
+			path:        p.path,
+			absPath:     p.absPath,
+			status:      p.status,
+			diffPending: !m.previewRaw && p.status.hasDiff(),
+		}
+		m.preview = p
+	}
+	p.loadPending, p.loadRequested = false, true
+	p.modTime, p.size, p.err = modTime, size, err
+	if err == nil {
+		p.truncated = size > int64(len(data))
+		p.setContent(data)
+	}
+	m.clampPreviewScroll()
+}
+
+// recheckPreview reads the previewed file again in case it changed on
+// disk.
+func (m *Model) recheckPreview() {
+	if p := m.preview; p != nil && !p.loadPending {
+		p.loadRequested = false
+	}
+}
+
+// finishDiff fills the preview with the diff fetched for path at modTime,
+// unless the preview has moved on since. Without a diff it keeps showing
+// the file's contents.
+func (m *Model) finishDiff(path string, modTime time.Time, diff string, err error) {
+	p := m.preview
+	if p == nil || !p.diffPending || p.path != path || !p.modTime.Equal(modTime) {
+		return
+	}
+	p.diffPending = false
+	if err == nil {
+		p.setDiff(diff)
+	}
+	m.clampPreviewScroll()
+}
+
+// setContent classifies data as binary or text and splits it into lines.
+func (p *filePreview) setContent(data []byte) {
+	sniff := data
+	if len(sniff) > previewSniffBytes {
+		sniff = sniff[:previewSniffBytes]
+	}
+	if bytes.IndexByte(sniff, 0) >= 0 {
+		p.binary = true
+		return
+	}
+
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	text = strings.TrimSuffix(text, "\n")
+	if text == "" {
+		return
+	}
+	p.lines = strings.Split(text, "\n")
+}
+
+// stale reports whether the cached preview no longer matches node. Changes
+// to the file's contents are caught by recheckPreview instead, so this
+// never touches the disk.
+func (p *filePreview) stale(node *tree.Node, status gitFileStatus) bool {
+	return p == nil || p.path != node.Path || p.isDir != node.IsDir || p.status != status
+}
+
+// syncPreview reloads the preview if the cursor moved to a different node
+// or its git status changed.
+func (m *Model) syncPreview() {
+	if !m.showPreview || len(m.flatNodes) == 0 {
+		return
+	}
+	m.clampCursor()
+	node := m.flatNodes[m.cursor]
+	if !m.preview.stale(node, m.gitStatusOf(node)) {
+		return
+	}
+	if m.preview == nil || m.preview.path != node.Path {
+		m.previewScroll = 0
+	}
+	m.preview = m.loadPreview(node)
+	m.clampPreviewScroll()
+}
+
+// scrollPreview moves the preview viewport by delta lines.
+func (m *Model) scrollPreview(delta int) {
+	m.previewScroll += delta
+	m.clampPreviewScroll()
+}
+
+func (m *Model) clampPreviewScroll() {
+	maxScroll := 0
+	if m.preview != nil {
+		maxScroll = len(m.preview.lines) - (m.viewportHeight() - 1)
+	}
+	if m.previewScroll > maxScroll {
+		m.previewScroll = maxScroll
+	}
+	if m.previewScroll < 0 {
+		m.previewScroll = 0
+	}
+}
+
+// paneWidths splits the terminal width between the tree and the preview.
+// previewWidth is 0 when the preview is hidden or doesn't fit.
+func (m Model) paneWidths() (treeWidth, previewWidth int) {
+	if !m.showPreview {
+		return m.width, 0
+	}
+	treeWidth = max(m.width*2/5, 24)
+	previewWidth = m.width - treeWidth - 1 // separator column
+	if previewWidth < previewMinWidth {
+		return m.width, 0
+	}
+	return treeWidth, previewWidth
+}
+
+// renderPreview returns exactly height lines of preview content, each
+// width cells wide.
+func (m Model) renderPreview(width, height int) []string {
+	lines := make([]string, 0, height)
+	p := m.preview
+
+	var header string
+	switch {
+	case p == nil:
+	case p.diffPending:
+		header = "diff · loading…"
+	case p.loadPending:
+		header = "loading…"
+	case p.err != nil:
+		header = p.err.Error()
+	case p.isDir:
+		header = fmt.Sprintf("directory · %d items", p.entries)
+	case p.diff:
+		header = fmt.Sprintf("diff · +%d −%d", p.added, p.removed)
+	case p.binary:
+		header = "binary · " + formatSize(p.size)
+	default:
+		count := fmt.Sprintf("%d lines", len(p.lines))
+		if p.truncated {
+			count = fmt.Sprintf("%d+ lines", len(p.lines))
+		}
+		header = formatSize(p.size) + " · " + count
+	}
+	lines = append(lines, previewHeaderStyle.Render(padRight(ansi.Truncate(" "+header, width, "…"), width)))
+
+	if p != nil && !p.binary && !p.isDir && !p.diffPending && !p.loadPending {
+		for i := m.previewScroll; i < len(p.lines) && len(lines) < height; i++ {
+			line := " " + sanitizePreviewLine(p.lines[i])
+			style := previewTextStyle
+			if p.diff {
+				style = diffLineStyle(p.lines[i])
+			}
+			lines = append(lines, style.Render(padRight(ansi.Truncate(line, width, "…"), width)))
+		}
+	}
+
+	for len(lines) < height {
+		lines = append(lines, strings.Repeat(" ", width))
+	}
+	return lines[:height]
+}
+
+// diffLineStyle picks the style for a line of unified diff output.
+func diffLineStyle(line string) lipgloss.Style {
+	switch {
+	case strings.HasPrefix(line, "+"):
+		return diffAddedStyle
+	case strings.HasPrefix(line, "-"):
+		return diffRemovedStyle
+	case strings.HasPrefix(line, "@@"):
+		return diffHunkStyle
+	}
+	return previewTextStyle
+}
+
+// sanitizePreviewLine expands tabs and replaces control characters and
+// invalid UTF-8 so file contents can't emit terminal escape sequences.
+func sanitizePreviewLine(line string) string {
+	var b strings.Builder
+	col := 0
+	for i := 0; i < len(line); {
+		r, size := utf8.DecodeRuneInString(line[i:])
+		i += size
+		switch {
+		case r == '\t':
+			n := previewTabWidth - col%previewTabWidth
+			b.WriteString(strings.Repeat(" ", n))
+			col += n
+			continue
+		case r == utf8.RuneError && size == 1, r < ' ', r == 0x7f:
+			r = '·'
+		}
+		b.WriteRune(r)
+		col++
+	}
+	return b.String()
+}
+
+// padRight pads s with spaces to width cells.
+func padRight(s string, width int) string {
+	if w := lipgloss.Width(s); w < width {
+		return s + strings.Repeat(" ", width-w)
+	}
+	return s
+}
+
+// formatSize renders a byte count in human-readable units.
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
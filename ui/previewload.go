@@ -0,0 +1,56 @@
+//go:build !js
+
+package ui
+
+import (
+	"io"
+	"os"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// previewLoadedMsg carries the contents of the previewed file, read in the
+// background.
+type previewLoadedMsg struct {
+	path    string
+	modTime time.Time
+	size    int64
+	data    []byte // at most previewMaxBytes
+	err     error
+}
+
+// requestPreview returns a command reading the file the preview is waiting
+// for (or rechecking), or nil if there is nothing to read.
+func (m Model) requestPreview() tea.Cmd {
+	p := m.preview
+	if p == nil || p.absPath == "" || p.loadRequested {
+		return nil
+	}
+	p.loadRequested = true
+	path, absPath := p.path, p.absPath
+	return func() tea.Msg {
+		msg := previewLoadedMsg{path: path}
+		msg.modTime, msg.size, msg.data, msg.err = readPreview(absPath)
+		return msg
+	}
+}
+
+// readPreview reads up to previewMaxBytes of the file at absPath.
+func readPreview(absPath string) (modTime time.Time, size int64, data []byte, err error) {
+	f, err := os.Open(absPath)
+	if err != nil {
+		return time.Time{}, 0, nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return time.Time{}, 0, nil, err
+	}
+	data, err = io.ReadAll(io.LimitReader(f, previewMaxBytes))
+	if err != nil {
+		return time.Time{}, 0, nil, err
+	}
+	return info.ModTime(), info.Size(), data, nil
+}
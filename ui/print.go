@@ -0,0 +1,127 @@
+//go:build !js
+
+package ui
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/almonk/bontree/config"
+	"github.com/almonk/bontree/icons"
+	"github.com/almonk/bontree/tree"
+)
+
+// PrintOptions controls the output of Print.
+type PrintOptions struct {
+	JSON  bool // print a JSON array instead of a tree listing
+	Depth int  // how many levels below the root to descend (0 = unlimited)
+	Icons bool // show Nerd Font icons in the tree listing
+}
+
+// printEntry is one node in Print's JSON output.
+type printEntry struct {
+	Path string `json:"path"`
+	Type string `json:"type"`
+	Git  string `json:"git,omitempty"`
+	Size *int64 `json:"size,omitempty"`
+}
+
+// Print writes the tree rooted at rootPath to w without starting the TUI,
+// applying the same hidden/gitignore filtering as the interactive view.
+// The listing is coloured by git status when the default lipgloss renderer
+// supports colour.
+func Print(w io.Writer, rootPath string, cfg *config.Config, opts PrintOptions) error {
+	if cfg == nil {
+		cfg = config.DefaultConfig()
+	}
+	t, err := tree.New(rootPath, treeOptions(cfg))
+	if err != nil {
+		return err
+	}
+	root, err := t.Build()
+	if err != nil {
+		return err
+	}
+	expandToDepth(root, opts.Depth)
+
+	files, _ := getGitFileStatus(rootPath, cfg.BaseRef)
+	m := Model{root: root, tree: t, rootPath: rootPath, gitFiles: files, cfg: cfg}
+
+	nodes := tree.Flatten(root)
+	if opts.JSON {
+		return m.printJSON(w, nodes[1:])
+	}
+	return m.printTree(w, nodes, opts.Icons)
+}
+
+func (m Model) printJSON(w io.Writer, nodes []*tree.Node) error {
+	entries := make([]printEntry, 0, len(nodes))
+	for _, node := range nodes {
+		e := printEntry{Path: node.Path, Type: "file"}
+		if node.IsDir {
+			e.Type = "directory"
+		} else if info, err := os.Lstat(node.AbsPath); err == nil {
+			size := info.Size()
+			e.Size = &size
+		}
+		e.Git = m.gitStatusOf(node).summary().name()
+		entries = append(entries, e)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(entries)
+}
+
+func (m Model) printTree(w io.Writer, nodes []*tree.Node, showIcons bool) error {
+	var dirs, files int
+	var b strings.Builder
+	for _, node := range nodes {
+		iconStyle, nameStyle := m.gitNodeStyles(node)
+		if node == m.root {
+			b.WriteString(nameStyle.Render(m.rootPath))
+			b.WriteString("\n")
+			continue
+		}
+		if node.IsDir {
+			dirs++
+		} else {
+			files++
+		}
+
+		b.WriteString(treeLineStyle.Render(printPrefix(node)))
+		if showIcons {
+			b.WriteString(iconStyle.Render(icons.GetIcon(node.Name, node.IsDir, node.Expanded)) + " ")
+		}
+		b.WriteString(nameStyle.Render(node.Name))
+		if status := m.gitStatusOf(node); !node.IsDir && hasStatusGlyph(status) {
+			b.WriteString("  " + renderStatusGlyph(status, nil))
+		}
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "\n%d directories, %d files\n", dirs, files)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// printPrefix returns tree(1)-style connectors for node, e.g. "│   ├── ".
+func printPrefix(node *tree.Node) string {
+	connector := "├── "
+	if node.IsLastChild() {
+		connector = "└── "
+	}
+	var parts []string
+	for ancestor := node.Parent; ancestor != nil && ancestor.Depth > 0; ancestor = ancestor.Parent {
+		if ancestor.IsLastChild() {
+			parts = append(parts, "    ")
+		} else {
+			parts = append(parts, "│   ")
+		}
+	}
+	for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+		parts[i], parts[j] = parts[j], parts[i]
+	}
+	return strings.Join(parts, "") + connector
+}
@@ -0,0 +1,238 @@
+package ui
+
+import (
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/almonk/bontree/tree"
+	"github.com/sahilm/fuzzy"
+)
+
+// parsedQuery is a search query split into its space-separated terms:
+// plain words, matched fuzzily, and filters such as "ext:go" that a node
+// must pass (or, negated with "!", fail).
+type parsedQuery struct {
+	words   []string
+	filters []queryFilter
+}
+
+// queryFilter reports whether a node passes one filter term. path is the
+// node's slash-separated path relative to the root.
+type queryFilter func(m *Model, node *tree.Node, path string) bool
+
+// parseQuery parses a search query. The operators are:
+//
+//	*.go, cmd/*/main.go  glob against the name, or the path if it has a slash
+//	re:_test\.go$        regexp against the path
+//	dir:ui               only paths under ui/
+//	ext:ts,tsx           only files with one of these extensions
+//	status:modified      only files with this git status
+//	!word, !ext:md       leave out paths containing word, or passing a filter
+//
+// An operator with nothing after its colon is ignored, so a half-typed one
+// doesn't empty the results.
+func parseQuery(query string) parsedQuery {
+	var q parsedQuery
+	for _, term := range strings.Fields(query) {
+		rest, negate := strings.CutPrefix(term, "!")
+		filter, isFilter := parseFilter(rest)
+		switch {
+		case !isFilter && !negate:
+			q.words = append(q.words, term)
+			continue
+		case !isFilter && rest != "":
+			word := strings.ToLower(rest)
+			filter = func(_ *Model, _ *tree.Node, path string) bool {
+				return strings.Contains(strings.ToLower(path), word)
+			}
+		}
+		if filter == nil {
+			continue
+		}
+		if negate {
+			filter = not(filter)
+		}
+		q.filters = append(q.filters, filter)
+	}
+	return q
+}
+
+// not returns a filter passing the nodes filter fails.
+func not(filter queryFilter) queryFilter {
+	return func(m *Model, node *tree.Node, path string) bool {
+		return !filter(m, node, path)
+	}
+}
+
+// none is the filter for a term that can't match, such as a bad regexp.
+func none(*Model, *tree.Node, string) bool { return false }
+
+// parseFilter returns the filter for an operator or glob term, reporting
+// false if term is a plain word. An ignored operator has a nil filter.
+func parseFilter(term string) (queryFilter, bool) {
+	op, value, ok := strings.Cut(term, ":")
+	if !ok {
+		if !strings.ContainsAny(term, "*?[") {
+			return nil, false
+		}
+		if _, err := path.Match(term, ""); err != nil {
+			return none, true
+		}
+		return func(_ *Model, node *tree.Node, p string) bool {
+			if !strings.Contains(term, "/") {
+				p = node.Name
+			}
+			matched, _ := path.Match(term, p)
+			return matched
+		}, true
+	}
+	if value == "" {
+		switch op {
+		case "re", "dir", "ext", "status":
+			return nil, true // still being typed
+		}
+		return nil, false
+	}
+	switch op {
+	case "re":
+		re, err := grepPattern(term)
+		if err != nil {
+			return none, true
+		}
+		return func(_ *Model, _ *tree.Node, p string) bool {
+			return re.MatchString(p)
+		}, true
+
+	case "dir":
+		dir := strings.Trim(strings.TrimPrefix(value, "./"), "/")
+		if dir == "" || dir == "." {
+			return nil, true
+		}
+		return func(_ *Model, _ *tree.Node, p string) bool {
+			return strings.HasPrefix(p, dir+"/")
+		}, true
+
+	case "ext":
+		exts := strings.Split(value, ",")
+		return func(_ *Model, node *tree.Node, _ string) bool {
+			if node.IsDir {
+				return false
+			}
+			ext := strings.TrimPrefix(filepath.Ext(node.Name), ".")
+			for _, want := range exts {
+				if strings.EqualFold(ext, strings.TrimPrefix(want, ".")) {
+					return true
+				}
+			}
+			return false
+		}, true
+
+	case "status":
+		statuses := strings.Split(strings.ToLower(value), ",")
+		return func(m *Model, node *tree.Node, _ string) bool {
+			if node.IsDir {
+				return false
+			}
+			for _, status := range statuses {
+				if m.hasStatus(node, status) {
+					return true
+				}
+			}
+			return false
+		}, true
+	}
+	return nil, false
+}
+
+// hasStatus reports whether node's git status matches status, which is a
+// change name such as "modified" (or the start of one, e.g. "mod"),
+// "staged", "unstaged" or "changed".
+func (m *Model) hasStatus(node *tree.Node, status string) bool {
+	s := m.gitStatusOf(node)
+	switch status {
+	case "staged":
+		return s.index != gitUnchanged
+	case "unstaged":
+		return s.worktree != gitUnchanged && s.worktree != gitIgnored
+	case "changed":
+		return m.isChanged(node)
+	}
+	name := s.summary().name()
+	return name != "" && strings.HasPrefix(name, status)
+}
+
+// matches reports whether node passes every filter in the query.
+func (q parsedQuery) matches(m *Model, node *tree.Node) bool {
+	p := filepath.ToSlash(strings.TrimPrefix(node.Path, "./"))
+	for _, filter := range q.filters {
+		if !filter(m, node, p) {
+			return false
+		}
+	}
+	return true
+}
+
+// empty reports whether the query has no words or filters.
+func (q parsedQuery) empty() bool {
+	return len(q.words) == 0 && len(q.filters) == 0
+}
+
+// findAll fuzzy-matches every word against src, keeping the items all of
+// them match, best total score first, with their matched indexes merged.
+// With no words, every item matches, in order.
+func findAll(words []string, src fuzzy.Source) fuzzy.Matches {
+	if len(words) == 0 {
+		all := make(fuzzy.Matches, src.Len())
+		for i := range all {
+			all[i] = fuzzy.Match{Str: src.String(i), Index: i}
+		}
+		return all
+	}
+	results := fuzzy.FindFrom(words[0], src)
+	for _, word := range words[1:] {
+		byIndex := make(map[int]fuzzy.Match)
+		for _, r := range fuzzy.FindFrom(word, src) {
+			byIndex[r.Index] = r
+		}
+		kept := results[:0]
+		for _, r := range results {
+			if other, ok := byIndex[r.Index]; ok {
+				r.Score += other.Score
+				r.MatchedIndexes = mergeIndexes(r.MatchedIndexes, other.MatchedIndexes)
+				kept = append(kept, r)
+			}
+		}
+		results = kept
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	return results
+}
+
+// findIndexes returns the merged indexes of every word that fuzzy-matches s.
+func findIndexes(words []string, s string) (indexes []int, ok bool) {
+	for _, word := range words {
+		if r := fuzzy.Find(word, []string{s}); len(r) > 0 {
+			indexes = mergeIndexes(indexes, r[0].MatchedIndexes)
+			ok = true
+		}
+	}
+	return indexes, ok
+}
+
+// mergeIndexes returns the sorted union of two sorted index lists.
+func mergeIndexes(a, b []int) []int {
+	merged := make([]int, 0, len(a)+len(b))
+	for len(a) > 0 || len(b) > 0 {
+		switch {
+		case len(b) == 0 || (len(a) > 0 && a[0] < b[0]):
+			merged, a = append(merged, a[0]), a[1:]
+		case len(a) == 0 || b[0] < a[0]:
+			merged, b = append(merged, b[0]), b[1:]
+		default:
+			merged, a, b = append(merged, a[0]), a[1:], b[1:]
+		}
+	}
+	return merged
+}
@@ -0,0 +1,86 @@
+package ui
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/almonk/bontree/tree"
+)
+
+func TestParseQuery(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"main.go", "cmd/bontree/main.go", "ui/view.go", "ui/view_test.go",
+		"README.md", "docs/guide.md", "web/app.ts", "web/app.tsx",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tr, err := tree.New(dir, tree.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := tr.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := Model{
+		root: root,
+		gitFiles: map[string]gitFileStatus{
+			"ui/view.go":    {worktree: gitModified},
+			"main.go":       {index: gitAdded},
+			"docs/guide.md": {worktree: gitUntracked},
+		},
+	}
+	var files []*tree.Node
+	for _, node := range tree.FlattenAll(root) {
+		if !node.IsDir {
+			files = append(files, node)
+		}
+	}
+
+	for _, tt := range []struct {
+		query string
+		words string // the words left to fuzzy-match
+		want  string // files passing the filters, sorted
+	}{
+		{"*.go", "", "cmd/bontree/main.go main.go ui/view.go ui/view_test.go"},
+		{"cmd/*/main.go", "", "cmd/bontree/main.go"},
+		{"!test", "", "README.md cmd/bontree/main.go docs/guide.md main.go ui/view.go web/app.ts web/app.tsx"},
+		{"view !test", "view", "README.md cmd/bontree/main.go docs/guide.md main.go ui/view.go web/app.ts web/app.tsx"},
+		{"!ext:md", "", "cmd/bontree/main.go main.go ui/view.go ui/view_test.go web/app.ts web/app.tsx"},
+		{"dir:./ui/", "", "ui/view.go ui/view_test.go"},
+		{"ext:ts,tsx", "", "web/app.ts web/app.tsx"},
+		{"status:mod", "", "ui/view.go"},
+		// Untracked files have nothing staged
+		{"status:staged", "", "main.go"},
+		{"status:unstaged", "", "docs/guide.md ui/view.go"},
+		{"re:_test\\.go$", "", "ui/view_test.go"},
+		{"re:(", "", ""},
+		// An operator still being typed doesn't filter anything
+		{"ext:", "", "README.md cmd/bontree/main.go docs/guide.md main.go ui/view.go ui/view_test.go web/app.ts web/app.tsx"},
+	} {
+		q := parseQuery(tt.query)
+		if words := strings.Join(q.words, " "); words != tt.words {
+			t.Errorf("parseQuery(%q) words = %q, want %q", tt.query, words, tt.words)
+		}
+		var got []string
+		for _, node := range files {
+			if q.matches(&m, node) {
+				got = append(got, filepath.ToSlash(node.Path))
+			}
+		}
+		sort.Strings(got)
+		if strings.Join(got, " ") != tt.want {
+			t.Errorf("parseQuery(%q) matches %v, want %s", tt.query, got, tt.want)
+		}
+	}
+}
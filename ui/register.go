@@ -0,0 +1,277 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// register holds the yanked or cut paths (absolute) waiting to be pasted.
+type register struct {
+	paths []string
+	cut   bool // move the files when pasting, rather than copy them
+}
+
+// PasteItem is one file or directory to paste.
+type PasteItem struct {
+	Src     string // absolute path to copy or move
+	Dest    string // absolute path to put it at
+	Replace bool   // move whatever is at Dest to the trash first
+}
+
+// PasteOp describes a paste for the caller to run in the background. A
+// trash runs the same way, since it copies when the trash is on another
+// filesystem.
+type PasteOp struct {
+	Cut   bool // move the files instead of copying them
+	Trash bool // move the files to the trash; Dest is unused
+	Items []PasteItem
+}
+
+// describe names what op pastes and where, e.g. "3 files" and "src/". For
+// a trash, into is "".
+func (op PasteOp) describe(m Model) (what, into string) {
+	names := make([]string, len(op.Items))
+	for i, item := range op.Items {
+		if op.Trash {
+			names[i] = m.treePath(item.Src)
+		} else {
+			names[i] = filepath.Base(item.Dest)
+		}
+	}
+	if op.Trash {
+		return describePaths(names), ""
+	}
+	return describePaths(names), dirLabel(m.treePath(filepath.Dir(op.Items[0].Dest)))
+}
+
+// pasteStatus is the progress of the running paste, shown in the status bar.
+type pasteStatus struct {
+	verb   string // "Pasting" or "Trashing"
+	desc   string // what is being pasted, e.g. "3 files"
+	copied int64  // bytes copied so far
+	total  int64  // bytes to copy, once known
+}
+
+// label describes the paste's progress for the status bar.
+func (p pasteStatus) label() string {
+	if p.total > 0 {
+		return fmt.Sprintf("%s %s %d%%", p.verb, p.desc, min(p.copied*100/p.total, 100))
+	}
+	return fmt.Sprintf("%s %s…", p.verb, p.desc)
+}
+
+// dirLabel names a directory in messages, e.g. "src/", or "./" for the root.
+func dirLabel(rel string) string {
+	if rel == "." {
+		return "./"
+	}
+	return dirPrefix(rel)
+}
+
+// yank puts the marked nodes, or the cursor node, in the register to be
+// copied (or with cut, moved) by the next paste.
+func (m *Model) yank(cut bool) KeyResult {
+	if m.tree == nil {
+		return KeyResult{}
+	}
+	nodes := m.fileTargets()
+	if len(nodes) == 0 {
+		return KeyResult{}
+	}
+	paths := make([]string, len(nodes))
+	for i, node := range nodes {
+		paths[i] = node.AbsPath
+	}
+	m.register = &register{paths: paths, cut: cut}
+	if cut {
+		return KeyResult{FlashMsg: fmt.Sprintf("Cut %s, paste to move", describePaths(nodePaths(nodes)))}
+	}
+	return KeyResult{FlashMsg: fmt.Sprintf("Yanked %s", describePaths(nodePaths(nodes)))}
+}
+
+// paste copies or moves the register's paths into the cursor directory, or
+// the cursor file's directory. If any of them already exist there, it asks
+// whether to skip, overwrite or rename them first.
+func (m *Model) paste() KeyResult {
+	if m.tree == nil || len(m.flatNodes) == 0 {
+		return KeyResult{}
+	}
+	if m.register == nil {
+		return KeyResult{FlashMsg: "Nothing to paste"}
+	}
+	if m.pasting != nil {
+		return KeyResult{FlashMsg: "✗ Wait for the paste to finish"}
+	}
+	dir := m.flatNodes[m.cursor]
+	if !dir.IsDir {
+		dir = dir.Parent
+	}
+
+	var items []PasteItem
+	var conflicts []int // indices into items
+	taken := make(map[string]bool)
+	for _, src := range m.register.paths {
+		dest := filepath.Join(dir.AbsPath, filepath.Base(src))
+		if _, err := os.Lstat(src); err != nil {
+			return KeyResult{FlashMsg: fmt.Sprintf("✗ %s no longer exists", m.treePath(src))}
+		}
+		if dest != src && strings.HasPrefix(dest, src+string(filepath.Separator)) {
+			return KeyResult{FlashMsg: fmt.Sprintf("✗ Can't paste %s into itself", filepath.Base(src))}
+		}
+		if m.register.cut && dest == src {
+			continue // already there
+		}
+		if _, err := os.Lstat(dest); err == nil || taken[dest] {
+			conflicts = append(conflicts, len(items))
+		}
+		taken[dest] = true
+		items = append(items, PasteItem{Src: src, Dest: dest})
+	}
+	if len(items) == 0 {
+		return KeyResult{FlashMsg: "Nothing to paste"}
+	}
+	op := PasteOp{Cut: m.register.cut, Items: items}
+	if len(conflicts) == 0 {
+		return m.startPaste(op)
+	}
+
+	names := make([]string, len(conflicts))
+	for i, c := range conflicts {
+		names[i] = filepath.Base(items[c].Dest)
+	}
+	verb := "exists"
+	if len(names) > 1 {
+		verb = "exist"
+	}
+	msg := fmt.Sprintf("%s already %s in %s: (s)kip, (o)verwrite, (r)ename?", describePaths(names), verb, dirLabel(dir.Path))
+	m.startChoice(msg, map[string]func(m *Model) KeyResult{
+		"s": func(m *Model) KeyResult {
+			op.Items = withoutItems(items, conflicts)
+			return m.startPaste(op)
+		},
+		"o": func(m *Model) KeyResult {
+			for _, c := range conflicts {
+				items[c].Replace = true
+				// Trashing a directory the source is in would trash it too
+				if strings.HasPrefix(items[c].Src, items[c].Dest+string(filepath.Separator)) {
+					return KeyResult{FlashMsg: fmt.Sprintf("✗ Can't overwrite %s, it contains %s", m.treePath(items[c].Dest), filepath.Base(items[c].Src))}
+				}
+			}
+			// Pasting a file over itself would trash the original
+			op.Items = items[:0:0]
+			for _, item := range items {
+				if item.Dest != item.Src {
+					op.Items = append(op.Items, item)
+				}
+			}
+			return m.startPaste(op)
+		},
+		"r": func(m *Model) KeyResult {
+			for _, c := range conflicts {
+				items[c].Dest = uniquePath(items[c].Dest, taken)
+				taken[items[c].Dest] = true
+			}
+			return m.startPaste(op)
+		},
+	})
+	return KeyResult{}
+}
+
+// withoutItems returns items except those at the given indices.
+func withoutItems(items []PasteItem, skip []int) []PasteItem {
+	skipped := make(map[int]bool, len(skip))
+	for _, i := range skip {
+		skipped[i] = true
+	}
+	var kept []PasteItem
+	for i, item := range items {
+		if !skipped[i] {
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
+
+// uniquePath returns path with a numeric suffix before its extension, e.g.
+// "main_2.go", choosing the first that doesn't exist and isn't taken.
+func uniquePath(path string, taken map[string]bool) string {
+	ext := filepath.Ext(path)
+	if info, err := os.Lstat(path); (err == nil && info.IsDir()) || ext == filepath.Base(path) {
+		ext = "" // directories and dotfiles like .env keep their whole name
+	}
+	stem := strings.TrimSuffix(path, ext)
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%s_%d%s", stem, i, ext)
+		if _, err := os.Lstat(candidate); err != nil && !taken[candidate] {
+			return candidate
+		}
+	}
+}
+
+// startPaste hands op to the caller to run, showing its progress until it
+// finishes.
+func (m *Model) startPaste(op PasteOp) KeyResult {
+	if len(op.Items) == 0 {
+		return KeyResult{FlashMsg: "Nothing to paste"}
+	}
+	desc, _ := op.describe(*m)
+	m.pasting = &pasteStatus{verb: "Pasting", desc: desc}
+	if op.Trash {
+		m.pasting.verb = "Trashing"
+	}
+	return KeyResult{Paste: &op}
+}
+
+// finishPaste records a finished (or failed) paste in the journal and moves
+// the cursor to the first pasted path. It returns the message to flash.
+func (m *Model) finishPaste(op PasteOp, changes []fileChange, err error) string {
+	m.pasting = nil
+	desc, into := op.describe(*m)
+	if op.Trash {
+		return m.finishTrash(desc, changes, err)
+	}
+	verb := "paste"
+	if op.Cut {
+		verb = "move"
+	}
+	m.journal.record(verb+" "+desc, changes...)
+	m.reloadTouched(changes)
+	if op.Cut && err == nil {
+		// The files are gone from where they were cut
+		m.register = nil
+	}
+
+	first := ""
+	for _, c := range changes {
+		if first = c.donePath(); first != "" {
+			break
+		}
+	}
+	note := m.afterFileOp(m.treePath(first))
+	if err != nil {
+		return fmt.Sprintf("✗ Paste: %s", err)
+	}
+	if op.Cut {
+		return fmt.Sprintf("✓ Moved %s to %s", desc, into) + note
+	}
+	return fmt.Sprintf("✓ Pasted %s into %s", desc, into) + note
+}
+
+// finishTrash records a finished (or failed) trash in the journal. The
+// cursor stays on the same row, which is now the node after the first one
+// removed. It returns the message to flash.
+func (m *Model) finishTrash(desc string, changes []fileChange, err error) string {
+	trashed := make([]string, len(changes))
+	for i, c := range changes {
+		trashed[i] = m.treePath(c.path)
+	}
+	m.journal.record("trash "+describePaths(trashed), changes...)
+	m.reloadTouched(changes)
+	m.afterFileOp("")
+	if err != nil {
+		return fmt.Sprintf("✗ Trash %s", err)
+	}
+	return fmt.Sprintf("✓ Moved %s to the trash", desc)
+}
@@ -0,0 +1,57 @@
+//go:build !js
+
+package ui
+
+import (
+	"context"
+	"os/exec"
+	"time"
+
+	"github.com/almonk/bontree/config"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// commandOutputMax limits how much of a command's output is kept; the end
+// is usually the interesting part.
+const commandOutputMax = 1024 * 1024
+
+// commandWaitDelay is how long a cancelled command's output is waited for,
+// in case something it started still holds it open.
+const commandWaitDelay = time.Second
+
+// commandDoneMsg is sent when a user command exits.
+type commandDoneMsg struct {
+	run       CommandRun
+	output    string
+	err       error
+	cancelled bool // the command was stopped by closing its pane
+}
+
+// shellCommand returns run's script as a command in the root directory,
+// killed if ctx is cancelled.
+func shellCommand(ctx context.Context, rootPath string, run CommandRun) *exec.Cmd {
+	c := exec.CommandContext(ctx, "sh", "-c", run.Script)
+	c.Dir = rootPath
+	c.WaitDelay = commandWaitDelay
+	return c
+}
+
+// startCommand runs a user command: interactive ones take over the
+// terminal like $EDITOR does, the others run in the background with their
+// output captured until they exit or ctx is cancelled.
+func startCommand(ctx context.Context, rootPath string, run CommandRun) tea.Cmd {
+	c := shellCommand(ctx, rootPath, run)
+	if run.Mode == config.CommandInteractive {
+		return tea.ExecProcess(c, func(err error) tea.Msg {
+			return commandDoneMsg{run: run, err: err}
+		})
+	}
+	killGroupOnCancel(c)
+	return func() tea.Msg {
+		out, err := c.CombinedOutput()
+		if len(out) > commandOutputMax {
+			out = out[len(out)-commandOutputMax:]
+		}
+		return commandDoneMsg{run: run, output: string(out), err: err, cancelled: ctx.Err() != nil}
+	}
+}
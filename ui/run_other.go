@@ -0,0 +1,8 @@
+//go:build !unix && !js
+
+package ui
+
+import "os/exec"
+
+// killGroupOnCancel does nothing here; cancelling kills just the shell.
+func killGroupOnCancel(c *exec.Cmd) {}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package ui
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// killGroupOnCancel runs c in a process group of its own and kills the whole
+// group when its context is cancelled, so whatever the shell started stops
+// too. Only for commands that don't use the terminal.
+func killGroupOnCancel(c *exec.Cmd) {
+	c.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	c.Cancel = func() error {
+		return syscall.Kill(-c.Process.Pid, syscall.SIGKILL)
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"strings"
 
 	"github.com/almonk/bontree/tree"
-	"github.com/sahilm/fuzzy"
 )
 
 // nodeSource implements fuzzy.Source for tree nodes, matching against relative path
@@ -54,6 +53,8 @@ func (m *Model) startSearch(flat bool) {
 }
 
 // applySearchFilter runs the appropriate fuzzy search and updates flatNodes/cursor.
+// The query's words are matched fuzzily and its operators filter the results
+// (see parseQuery).
 func (m *Model) applySearchFilter() {
 	if m.flatSearch {
 		m.updateFlatSearch()
@@ -63,7 +64,7 @@ func (m *Model) applySearchFilter() {
 	if m.searchNodes != nil {
 		m.flatNodes = m.searchNodes
 	} else {
-		m.flatNodes = flattenTree(m.root)
+		m.flatNodes = m.visibleNodes()
 	}
 	m.cursor = 0
 	m.scrollOff = 0
@@ -86,22 +87,23 @@ func (m *Model) jumpToMatch(dir int) {
 }
 
 func (m *Model) updateSearch() {
-	if m.searchQuery == "" {
+	q := parseQuery(m.searchQuery)
+	if q.empty() {
 		m.searchNodes = nil
 		m.searchMatchIndices = nil
 		m.searchPathIndices = nil
-		m.searchPathIndices = nil
 		return
 	}
 
-	allNodes := tree.FlattenAll(m.root)
+	allNodes := m.searchableNodes()
+	candidates := m.filterNodes(allNodes, q)
 	// Tree mode: match against node names only for stricter results
-	results := fuzzy.FindFrom(m.searchQuery, nodeNameSource(allNodes))
+	results := findAll(q.words, nodeNameSource(candidates))
 
 	nameMap := make(map[*tree.Node][]int)
 	matchSet := make(map[*tree.Node]bool)
 	for _, r := range results {
-		node := allNodes[r.Index]
+		node := candidates[r.Index]
 		nameMap[node] = r.MatchedIndexes
 		matchSet[node] = true
 		for ancestor := node.Parent; ancestor != nil && !matchSet[ancestor]; ancestor = ancestor.Parent {
@@ -123,37 +125,34 @@ func (m *Model) updateSearch() {
 
 // updateFlatSearch does a flat fuzzy search — no hierarchy, files first then dirs.
 func (m *Model) updateFlatSearch() {
-	if m.searchQuery == "" {
+	q := parseQuery(m.searchQuery)
+	if q.empty() {
 		m.searchNodes = nil
 		m.searchMatchIndices = nil
 		m.searchPathIndices = nil
-		m.searchPathIndices = nil
 		return
 	}
 
-	allNodes := tree.FlattenAll(m.root)
-	results := fuzzy.FindFrom(m.searchQuery, nodeSource(allNodes))
+	candidates := m.filterNodes(m.searchableNodes(), q)
+	results := findAll(q.words, nodeSource(candidates))
 
 	nameMap := make(map[*tree.Node][]int)
 	pathMap := make(map[*tree.Node][]int)
 	var files, dirs []*tree.Node
 	for _, r := range results {
-		node := allNodes[r.Index]
+		node := candidates[r.Index]
 		path := strings.TrimPrefix(node.Path, "./")
 
 		// Prefer direct fuzzy match against name/path for better highlights;
 		// fall back to splitting full-path match indices.
-		var nameIdx, pathIdx []int
-		if nr := fuzzy.Find(m.searchQuery, []string{node.Name}); len(nr) > 0 {
-			nameIdx = nr[0].MatchedIndexes
-		} else {
+		nameIdx, ok := findIndexes(q.words, node.Name)
+		if !ok {
 			nameIdx, _ = splitMatchIndices(r.MatchedIndexes, path, node.Name)
 		}
+		var pathIdx []int
 		if node.Parent != nil && node.Parent != m.root {
 			dirPath := strings.TrimPrefix(node.Parent.Path, "./")
-			if pr := fuzzy.Find(m.searchQuery, []string{dirPath}); len(pr) > 0 {
-				pathIdx = pr[0].MatchedIndexes
-			} else {
+			if pathIdx, ok = findIndexes(q.words, dirPath); !ok {
 				_, pathIdx = splitMatchIndices(r.MatchedIndexes, path, node.Name)
 			}
 		}
@@ -171,25 +170,95 @@ func (m *Model) updateFlatSearch() {
 	m.searchPathIndices = pathMap
 }
 
+// filterNodes returns the nodes that pass the query's filters.
+func (m *Model) filterNodes(nodes []*tree.Node, q parsedQuery) []*tree.Node {
+	if len(q.filters) == 0 {
+		return nodes
+	}
+	var kept []*tree.Node
+	for _, node := range nodes {
+		if q.matches(m, node) {
+			kept = append(kept, node)
+		}
+	}
+	return kept
+}
+
+// searchableNodes returns every node below the root that search can match,
+// limited to changed files when the changed-files view is on.
+func (m *Model) searchableNodes() []*tree.Node {
+	nodes := tree.FlattenAll(m.root)
+	if !m.changedOnly {
+		return nodes
+	}
+	filtered := nodes[:0]
+	for _, node := range nodes {
+		if m.isChanged(node) {
+			filtered = append(filtered, node)
+		}
+	}
+	return filtered
+}
+
+// clearFilter leaves filter mode, restoring the tree as it was before the
+// search started.
+func (m *Model) clearFilter() {
+	m.filtered = false
+	m.flatSearch = false
+	m.searchQuery = ""
+	m.searchNodes = nil
+	m.searchMatchIndices = nil
+	m.searchPathIndices = nil
+	m.restoreExpandedState()
+}
+
+// setFilter runs query as a confirmed search, as if typed after / (or
+// ctrl+f when flat) and accepted with enter. An empty query clears the
+// filter.
+func (m *Model) setFilter(query string, flat bool) {
+	if m.searching || m.filtered {
+		m.searching = false
+		m.clearFilter()
+	}
+	if query == "" {
+		return
+	}
+	m.startSearch(flat)
+	m.searchQuery = query
+	m.applySearchFilter()
+	m.searching = false
+	m.filtered = true
+	if m.searchNodes != nil {
+		m.flatNodes = m.searchNodes
+	}
+	m.clampCursor()
+}
+
 // --- Expand/Collapse state save/restore ---
 
 func (m *Model) saveExpandedState() {
 	m.savedExpanded = make(map[*tree.Node]bool)
-	for _, n := range tree.FlattenAll(m.root) {
-		if n.IsDir {
-			m.savedExpanded[n] = n.Expanded
-		}
+	for _, n := range tree.LoadedDirs(m.root) {
+		m.savedExpanded[n] = n.Expanded
 	}
 	m.savedCursor = m.cursor
 	m.savedScrollOff = m.scrollOff
 }
 
+// restoreExpandedState puts back the expanded state saved when the search
+// started. Directories the search loaded are unloaded again, so they stop
+// being watched and re-read.
 func (m *Model) restoreExpandedState() {
 	if m.savedExpanded == nil {
 		return
 	}
-	for node, expanded := range m.savedExpanded {
-		node.Expanded = expanded
+	_, sameRoot := m.savedExpanded[m.root]
+	for _, node := range tree.LoadedDirs(m.root) {
+		if expanded, ok := m.savedExpanded[node]; ok {
+			node.Expanded = expanded
+		} else if sameRoot {
+			node.Unload()
+		}
 	}
 	m.refreshFlatNodes()
 	m.cursor = m.savedCursor
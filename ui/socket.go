@@ -0,0 +1,248 @@
+//go:build !js
+
+package ui
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// controlWriteTimeout bounds how long a slow client can hold up an event.
+const controlWriteTimeout = 200 * time.Millisecond
+
+// controlMsg carries a request from a socket client into Update; the
+// response is sent back on reply.
+type controlMsg struct {
+	req   controlRequest
+	reply chan controlResponse
+}
+
+// controlServer accepts line-delimited JSON commands on a Unix socket and
+// feeds them to the model as controlMsgs.
+type controlServer struct {
+	ln       net.Listener
+	requests chan controlMsg
+
+	mu          sync.Mutex
+	subscribers map[*controlConn]bool
+	last        *controlState // state last sent to subscribers (UI goroutine only)
+}
+
+// controlConn is one client connection. Responses and events may be
+// written from different goroutines, so writes are serialised.
+type controlConn struct {
+	conn net.Conn
+	mu   sync.Mutex
+
+	events chan controlResponse // the next event for a subscriber to write
+	done   chan struct{}        // closed when the client disconnects
+}
+
+func newControlConn(conn net.Conn) *controlConn {
+	return &controlConn{
+		conn:   conn,
+		events: make(chan controlResponse, 1),
+		done:   make(chan struct{}),
+	}
+}
+
+func (c *controlConn) write(resp controlResponse) error {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(controlWriteTimeout))
+	_, err = c.conn.Write(append(data, '\n'))
+	return err
+}
+
+// send queues an event without blocking. If the last one hasn't been
+// written yet it's replaced, since only the latest state matters.
+func (c *controlConn) send(event controlResponse) {
+	select {
+	case c.events <- event:
+		return
+	default:
+	}
+	select {
+	case <-c.events:
+	default:
+	}
+	select {
+	case c.events <- event:
+	default:
+	}
+}
+
+// writeEvents writes queued events until the client disconnects. A client
+// that can't keep up is dropped.
+func (c *controlConn) writeEvents() {
+	for {
+		select {
+		case event := <-c.events:
+			if c.write(event) != nil {
+				c.conn.Close()
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// newControlServer listens on the Unix socket at path. A leftover socket
+// file from a previous run is replaced, but one that is still being served,
+// or a file that isn't a socket, is an error. An empty path disables the
+// server.
+func newControlServer(path string) (*controlServer, error) {
+	if path == "" {
+		return nil, nil
+	}
+	ln, err := net.Listen("unix", path)
+	if errors.Is(err, syscall.EADDRINUSE) {
+		if conn, dialErr := net.Dial("unix", path); dialErr == nil {
+			conn.Close()
+			return nil, fmt.Errorf("control socket %s is already in use", path)
+		}
+		if info, statErr := os.Lstat(path); statErr != nil || info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("control socket %s: file exists and is not a socket", path)
+		}
+		os.Remove(path)
+		ln, err = net.Listen("unix", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("control socket: %w", err)
+	}
+	s := &controlServer{
+		ln:          ln,
+		requests:    make(chan controlMsg),
+		subscribers: make(map[*controlConn]bool),
+	}
+	go s.accept()
+	return s, nil
+}
+
+func (s *controlServer) accept() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.serve(newControlConn(conn))
+	}
+}
+
+// serve reads requests from one client until it disconnects.
+func (s *controlServer) serve(c *controlConn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.subscribers, c)
+		s.mu.Unlock()
+		close(c.done)
+		c.conn.Close()
+	}()
+
+	scanner := bufio.NewScanner(c.conn)
+	for scanner.Scan() {
+		var req controlRequest
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			if c.write(controlResponse{Error: "invalid request: " + err.Error()}) != nil {
+				return
+			}
+			continue
+		}
+
+		reply := make(chan controlResponse, 1)
+		s.requests <- controlMsg{req: req, reply: reply}
+		resp := <-reply
+
+		if req.Cmd == "subscribe" && resp.OK {
+			s.mu.Lock()
+			if !s.subscribers[c] {
+				s.subscribers[c] = true
+				go c.writeEvents()
+			}
+			s.mu.Unlock()
+		}
+		if c.write(resp) != nil {
+			return
+		}
+	}
+}
+
+// next waits for the next client request.
+func (s *controlServer) next() tea.Cmd {
+	if s == nil {
+		return nil
+	}
+	return func() tea.Msg {
+		return <-s.requests
+	}
+}
+
+// notify queues m's state for subscribers if the cursor, marks or filter
+// changed since the last event.
+func (s *controlServer) notify(m Model) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	subscribers := make([]*controlConn, 0, len(s.subscribers))
+	for c := range s.subscribers {
+		subscribers = append(subscribers, c)
+	}
+	s.mu.Unlock()
+	if len(subscribers) == 0 {
+		s.last = nil
+		return
+	}
+
+	state := m.controlState()
+	if s.last != nil && sameControlState(*s.last, state) {
+		return
+	}
+	s.last = &state
+	for _, c := range subscribers {
+		c.send(controlResponse{OK: true, Event: "state", State: &state})
+	}
+}
+
+func sameControlState(a, b controlState) bool {
+	if a.Cursor != b.Cursor || a.Filter != b.Filter || len(a.Marks) != len(b.Marks) {
+		return false
+	}
+	for i := range a.Marks {
+		if a.Marks[i] != b.Marks[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// close stops the server and removes the socket file.
+func (s *controlServer) close() {
+	if s != nil {
+		s.ln.Close()
+	}
+}
+
+// Close releases the control socket and filesystem watches, and removes
+// the files saved for undo. Call it after the program exits.
+func (m Model) Close() {
+	m.control.close()
+	m.journal.close()
+	if m.watcher != nil {
+		m.watcher.w.Close()
+	}
+}
@@ -0,0 +1,8 @@
+//go:build js
+
+package ui
+
+// controlServer is unavailable in the browser demo, which has no sockets.
+type controlServer struct{}
+
+func newControlServer(string) (*controlServer, error) { return nil, nil }
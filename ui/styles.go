@@ -120,10 +120,22 @@ var (
 	statusPathStyle             lipgloss.Style
 	statusBranchStyle           lipgloss.Style
 	statusFlashStyle            lipgloss.Style
+	statusConfirmStyle          lipgloss.Style
 	statusHelpStyle             lipgloss.Style
 	statusFilterTagStyle        lipgloss.Style
 	searchInputStyle            lipgloss.Style
 	searchPromptStyle           lipgloss.Style
+	previewHeaderStyle          lipgloss.Style
+	previewTextStyle            lipgloss.Style
+	previewBorderStyle          lipgloss.Style
+	diffAddedStyle              lipgloss.Style
+	diffRemovedStyle            lipgloss.Style
+	diffHunkStyle               lipgloss.Style
+	gitStagedStyle              lipgloss.Style
+	gitUnstagedStyle            lipgloss.Style
+	gitCommittedStyle           lipgloss.Style
+	markStyle                   lipgloss.Style
+	statusMarkStyle             lipgloss.Style
 )
 
 // Color aliases used by view.go for status bar rendering.
@@ -220,6 +232,7 @@ func ApplyTheme(t *theme.Theme) {
 	statusPathStyle = statusBase.Foreground(colors.fgDim).PaddingLeft(1).PaddingRight(1)
 	statusBranchStyle = statusBase.Foreground(colors.purple).Bold(true)
 	statusFlashStyle = statusBase.Foreground(colors.green).Bold(true).PaddingLeft(1)
+	statusConfirmStyle = statusBase.Foreground(colors.red).Bold(true).PaddingLeft(1)
 	statusHelpStyle = statusBase.Foreground(colors.gutter)
 
 	statusFilterTagStyle = lipgloss.NewStyle().
@@ -229,4 +242,40 @@ func ApplyTheme(t *theme.Theme) {
 
 	searchInputStyle = statusBase.Foreground(colors.fg).PaddingLeft(1)
 	searchPromptStyle = statusBase.Foreground(colors.gutter).PaddingLeft(1)
+
+	previewHeaderStyle = lipgloss.NewStyle().
+		Foreground(colors.comment)
+
+	previewTextStyle = lipgloss.NewStyle().
+		Foreground(colors.fgDim)
+
+	previewBorderStyle = lipgloss.NewStyle().
+		Foreground(colors.gutter)
+
+	diffAddedStyle = lipgloss.NewStyle().
+		Foreground(colors.green)
+
+	diffRemovedStyle = lipgloss.NewStyle().
+		Foreground(colors.red)
+
+	diffHunkStyle = lipgloss.NewStyle().
+		Foreground(colors.cyan)
+
+	gitStagedStyle = lipgloss.NewStyle().
+		Foreground(colors.green).
+		Bold(true)
+
+	gitUnstagedStyle = lipgloss.NewStyle().
+		Foreground(colors.red).
+		Bold(true)
+
+	gitCommittedStyle = lipgloss.NewStyle().
+		Foreground(colors.purple).
+		Bold(true)
+
+	markStyle = lipgloss.NewStyle().
+		Foreground(colors.yellow).
+		Bold(true)
+
+	statusMarkStyle = statusBase.Foreground(colors.yellow).Bold(true)
 }
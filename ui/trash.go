@@ -0,0 +1,218 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// trashDir returns the XDG trash directory, $XDG_DATA_HOME/Trash.
+func trashDir() (string, error) {
+	data := os.Getenv("XDG_DATA_HOME")
+	if data == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		data = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(data, "Trash"), nil
+}
+
+// trashFor returns the trash to move abs into, following the XDG trash
+// spec so trashing never copies: the home trash if abs is on the same
+// filesystem, otherwise a trash at the top of abs's filesystem. top is that
+// filesystem's top directory, which .trashinfo paths are relative to, or ""
+// for the home trash.
+func trashFor(abs string) (dir, top string, err error) {
+	home, err := trashDir()
+	if err != nil {
+		return "", "", err
+	}
+	dev, ok := deviceOf(filepath.Dir(abs))
+	if !ok {
+		return home, "", nil
+	}
+	// The home trash may not exist yet; its nearest parent that does is
+	// on the same filesystem
+	existing := home
+	for {
+		if _, err := os.Stat(existing); err == nil || filepath.Dir(existing) == existing {
+			break
+		}
+		existing = filepath.Dir(existing)
+	}
+	if homeDev, ok := deviceOf(existing); !ok || homeDev == dev {
+		return home, "", nil
+	}
+
+	top = filepath.Dir(abs)
+	for parent := filepath.Dir(top); parent != top; parent = filepath.Dir(top) {
+		if d, ok := deviceOf(parent); !ok || d != dev {
+			break
+		}
+		top = parent
+	}
+	// An administrator may have set up a shared .Trash with the sticky
+	// bit, holding a directory per user; otherwise each user has their own
+	uid := strconv.Itoa(os.Getuid())
+	if info, err := os.Lstat(filepath.Join(top, ".Trash")); err == nil && info.IsDir() && info.Mode()&os.ModeSticky != 0 {
+		dir = filepath.Join(top, ".Trash", uid)
+		if os.MkdirAll(dir, 0o700) == nil {
+			return dir, top, nil
+		}
+	}
+	return filepath.Join(top, ".Trash-"+uid), top, nil
+}
+
+// moveToTrash moves the file or directory at abs into the XDG trash, with
+// the .trashinfo file file managers use to restore it, and returns where it
+// went. progress is passed to copyAll if the file has to be copied after
+// all.
+func moveToTrash(abs string, progress func(n int64)) (string, error) {
+	dir, top, err := trashFor(abs)
+	if err != nil {
+		return "", err
+	}
+	filesDir := filepath.Join(dir, "files")
+	infoDir := filepath.Join(dir, "info")
+	for _, d := range []string{filesDir, infoDir} {
+		if err := os.MkdirAll(d, 0o700); err != nil {
+			if top != "" {
+				return "", fmt.Errorf("no trash on the filesystem at %s: %w", top, err)
+			}
+			return "", err
+		}
+	}
+
+	// Claim a unique name by creating its info file exclusively
+	path := abs
+	if top != "" {
+		path, _ = filepath.Rel(top, abs)
+	}
+	info := fmt.Sprintf("[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+		(&url.URL{Path: path}).EscapedPath(), time.Now().Format("2006-01-02T15:04:05"))
+	base := filepath.Base(abs)
+	for i := 1; ; i++ {
+		name := base
+		if i > 1 {
+			name = fmt.Sprintf("%s.%d", base, i)
+		}
+		infoPath := filepath.Join(infoDir, name+".trashinfo")
+		f, err := os.OpenFile(infoPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		_, err = f.WriteString(info)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		dest := filepath.Join(filesDir, name)
+		if err == nil {
+			err = moveFile(abs, dest, progress)
+		}
+		if err != nil {
+			os.Remove(infoPath)
+			return "", err
+		}
+		return dest, nil
+	}
+}
+
+// restoreFromTrash moves a file trashed by moveToTrash back to path, and
+// removes its .trashinfo file.
+func restoreFromTrash(trashed, path string) error {
+	if err := moveBack(trashed, path); err != nil {
+		return err
+	}
+	info := filepath.Join(filepath.Dir(filepath.Dir(trashed)), "info", filepath.Base(trashed)+".trashinfo")
+	os.Remove(info)
+	return nil
+}
+
+// moveFile renames src to dest, copying and removing it when they are on
+// different filesystems, with progress as for copyAll.
+func moveFile(src, dest string, progress func(n int64)) error {
+	err := os.Rename(src, dest)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	if err := copyAll(src, dest, progress); err != nil {
+		os.RemoveAll(dest)
+		return err
+	}
+	return os.RemoveAll(src)
+}
+
+// copyAll copies the file, symlink or directory tree at src to dest, which
+// must not exist. If progress isn't nil, it's called with the number of
+// bytes written after each chunk.
+func copyAll(src, dest string, progress func(n int64)) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(target, dest)
+
+	case info.IsDir():
+		if err := os.Mkdir(dest, info.Mode().Perm()); err != nil {
+			return err
+		}
+		entries, err := os.ReadDir(src)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := copyAll(filepath.Join(src, entry.Name()), filepath.Join(dest, entry.Name()), progress); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	var w io.Writer = out
+	if progress != nil {
+		w = progressWriter{out, progress}
+	}
+	if _, err := io.Copy(w, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// progressWriter reports the size of every write.
+type progressWriter struct {
+	w        io.Writer
+	progress func(n int64)
+}
+
+func (p progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.progress(int64(n))
+	return n, err
+}
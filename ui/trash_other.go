@@ -0,0 +1,7 @@
+//go:build !unix
+
+package ui
+
+// deviceOf can't tell filesystems apart here, so everything goes to the
+// home trash.
+func deviceOf(path string) (uint64, bool) { return 0, false }
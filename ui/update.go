@@ -3,15 +3,28 @@
 package ui
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"time"
 
+	"github.com/almonk/bontree/config"
 	"github.com/atotto/clipboard"
 	tea "github.com/charmbracelet/bubbletea"
 )
 
+// lineArgEditors are the editors known to take "+N" to open a file at line
+// N. Others, such as code, would open a file named "+N", so they get just
+// the file.
+var lineArgEditors = map[string]bool{
+	"vi": true, "vim": true, "nvim": true, "gvim": true, "view": true,
+	"emacs": true, "emacsclient": true, "nano": true, "pico": true,
+	"micro": true, "hx": true, "helix": true, "kak": true, "joe": true,
+	"mg": true, "ne": true,
+}
+
 // editorFinishedMsg is sent when the external editor process exits.
 type editorFinishedMsg struct{ err error }
 
@@ -24,14 +37,44 @@ func flash(m *Model, msg string) tea.Cmd {
 }
 
 func (m Model) Init() tea.Cmd {
-	return tea.Batch(fetchGitInfo(m.rootPath), gitRefreshTick())
+	// A message set by New, e.g. for a --select path that is hidden
+	var flashCmd tea.Cmd
+	if m.flashMsg != "" {
+		flashCmd = flash(&m, m.flashMsg)
+	}
+	if m.watcher != nil {
+		return tea.Batch(fetchGitInfo(m.tree, m.lineCache, m.rootPath, m.baseRef), m.watcher.wait(), m.control.next(), flashCmd)
+	}
+	return tea.Batch(fetchGitInfo(m.tree, m.lineCache, m.rootPath, m.baseRef), gitRefreshTick(), m.control.next(), flashCmd)
 }
 
 func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	next, cmd := m.update(msg)
+	// Any message may have loaded new directories (expand, search, refresh);
+	// keep the watcher subscribed to exactly the loaded set.
+	if nm, ok := next.(Model); ok {
+		nm.watcher.sync(nm.root, nm.tree.Loads())
+		nm.syncPreview()
+		nm.control.notify(nm)
+		if loadCmd := nm.requestPreview(); loadCmd != nil {
+			cmd = tea.Batch(cmd, loadCmd)
+		}
+		if diffCmd := nm.requestDiff(); diffCmd != nil {
+			cmd = tea.Batch(cmd, diffCmd)
+		}
+		next = nm
+	}
+	return next, cmd
+}
+
+func (m Model) update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.WindowSizeMsg:
 		m.width = msg.Width
 		m.height = msg.Height
+		m.clampPreviewScroll()
+		m.clampOutputScroll()
+		m.moveGrepCursor(0)
 		return m, nil
 
 	case clearFlashMsg:
@@ -41,27 +84,136 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case gitInfoMsg:
 		m.gitBranch = msg.branch
 		m.gitFiles = msg.fileStatus
-		if !m.searching {
+		m.gitLines = msg.lineCounts
+		m.gitPending = false
+
+		// Report a bad base ref once, not on every refresh
+		var flashCmd tea.Cmd
+		baseErr := ""
+		if msg.err != nil {
+			baseErr = msg.err.Error()
+			if baseErr != m.baseErr {
+				flashCmd = flash(&m, fmt.Sprintf("✗ Base %s: %s", m.baseRef, baseErr))
+			}
+		}
+		m.baseErr = baseErr
+
+		if m.watcher == nil && !m.searching {
 			m.refreshTree()
 		}
-		return m, gitRefreshTick()
+		if m.watcher == nil {
+			// Polling is the only sign the previewed file changed
+			m.recheckPreview()
+		}
+		if m.watcher != nil && msg.ignoredChanged {
+			m.reloadLoadedDirs()
+		}
+		if m.changedOnly && !m.searching {
+			m.revealChanged()
+			m.refreshFlatNodesKeepCursor()
+		}
+		if m.watcher == nil {
+			return m, tea.Batch(flashCmd, gitRefreshTick())
+		}
+		if m.gitStale {
+			m.gitStale = false
+			return m, tea.Batch(flashCmd, m.requestGitInfo())
+		}
+		return m, flashCmd
 
 	case gitRefreshMsg:
-		return m, fetchGitInfo(m.rootPath)
+		return m, m.requestGitInfo()
+
+	case fsChangedMsg:
+		m.applyFSChanges(msg.dirs)
+		m.recheckPreview()
+		if msg.git {
+			return m, tea.Batch(m.requestGitInfo(), m.watcher.wait())
+		}
+		return m, m.watcher.wait()
 
 	case tea.MouseMsg:
 		return m.updateMouse(msg)
 
+	case controlMsg:
+		msg.reply <- m.handleControl(msg.req)
+		return m, m.control.next()
+
+	case gitOpDoneMsg:
+		var cmds []tea.Cmd
+		if msg.err != nil {
+			cmds = append(cmds, flash(&m, fmt.Sprintf("✗ git: %s", msg.err)))
+		}
+		// Replace the optimistic status with the real one
+		m.preview = nil
+		cmds = append(cmds, m.requestGitInfo())
+		return m, tea.Batch(cmds...)
+
+	case commandDoneMsg:
+		var cmds []tea.Cmd
+		switch msg.run.Mode {
+		case config.CommandInteractive:
+			if m.cfg.Mouse {
+				cmds = append(cmds, func() tea.Msg { return tea.EnableMouseAllMotion() })
+			}
+			if msg.err != nil {
+				cmds = append(cmds, flash(&m, fmt.Sprintf("✗ %s: %s", msg.run.Name, msg.err)))
+			}
+		case config.CommandPane:
+			if !m.finishCommand(msg.run.ID, msg.output, msg.err) && !msg.cancelled {
+				// The pane was closed while the command ran
+				cmds = append(cmds, flash(&m, commandSummary(msg.run.Name, msg.output, msg.err)))
+			}
+		default:
+			cmds = append(cmds, flash(&m, commandSummary(msg.run.Name, msg.output, msg.err)))
+		}
+		// The command may have changed files
+		m.preview = nil
+		if m.watcher == nil {
+			m.refreshTree()
+		}
+		cmds = append(cmds, m.requestGitInfo())
+		return m, tea.Batch(cmds...)
+
+	case pasteProgressMsg:
+		if m.pasting != nil {
+			m.pasting.copied, m.pasting.total = msg.copied, msg.total
+		}
+		return m, msg.job.wait()
+
+	case pasteDoneMsg:
+		msgText := m.finishPaste(msg.op, msg.changes, msg.err)
+		return m, tea.Batch(flash(&m, msgText), m.requestGitInfo())
+
+	case grepResultsMsg:
+		if !m.addGrepResults(msg.grepBatch) || msg.done {
+			return m, nil
+		}
+		return m, msg.job.wait()
+
+	case previewLoadedMsg:
+		m.finishLoad(msg.path, msg.modTime, msg.size, msg.data, msg.err)
+		return m, nil
+
+	case previewDiffMsg:
+		m.finishDiff(msg.path, msg.modTime, msg.diff, msg.err)
+		return m, nil
+
 	case editorFinishedMsg:
 		m.refreshTree()
-		reEnableMouse := func() tea.Msg { return tea.EnableMouseAllMotion() }
+		var reEnableMouse tea.Cmd
+		if m.cfg.Mouse {
+			reEnableMouse = func() tea.Msg { return tea.EnableMouseAllMotion() }
+		}
 		if msg.err != nil {
 			return m, tea.Batch(reEnableMouse, flash(&m, fmt.Sprintf("✗ Editor error: %s", msg.err)))
 		}
 		return m, reEnableMouse
 
 	case tea.KeyMsg:
-		isRune := msg.Type == tea.KeyRunes
+		// A typed space arrives as KeySpace rather than as a rune, but it is
+		// text all the same in the search, grep and input prompts
+		isRune := msg.Type == tea.KeyRunes || msg.Type == tea.KeySpace
 		result := m.HandleKey(msg.String(), isRune)
 		return m.applyKeyResult(result)
 	}
@@ -88,12 +240,44 @@ func (m Model) applyKeyResult(r KeyResult) (tea.Model, tea.Cmd) {
 		cmds = append(cmds, flash(&m, r.FlashMsg))
 	}
 
+	if r.RefreshGit {
+		cmds = append(cmds, m.requestGitInfo())
+	}
+
+	if r.Git != nil {
+		cmds = append(cmds, runGitOp(m.rootPath, *r.Git))
+	}
+
+	if r.Command != nil {
+		ctx := context.Background()
+		if r.Command.Mode == config.CommandPane && m.output != nil {
+			var cancel func()
+			ctx, cancel = context.WithCancel(ctx)
+			m.output.cancel = cancel
+		}
+		cmds = append(cmds, startCommand(ctx, m.rootPath, *r.Command))
+	}
+
+	if r.Paste != nil {
+		cmds = append(cmds, startPaste(*r.Paste))
+	}
+
+	if r.Grep != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		m.grep.cancel = cancel
+		cmds = append(cmds, startGrep(ctx, m.tree, m.root.AbsPath, *r.Grep))
+	}
+
 	if r.OpenEditor != "" {
 		editor := os.Getenv("EDITOR")
 		if editor == "" {
 			cmds = append(cmds, flash(&m, "✗ $EDITOR is not set"))
 		} else {
-			c := exec.Command(editor, r.OpenEditor)
+			args := []string{r.OpenEditor}
+			if r.EditorLine > 0 && lineArgEditors[filepath.Base(editor)] {
+				args = []string{fmt.Sprintf("+%d", r.EditorLine), r.OpenEditor}
+			}
+			c := exec.Command(editor, args...)
 			cmds = append(cmds, tea.ExecProcess(c, func(err error) tea.Msg {
 				return editorFinishedMsg{err}
 			}))
@@ -107,6 +291,27 @@ func (m Model) applyKeyResult(r KeyResult) (tea.Model, tea.Cmd) {
 }
 
 func (m Model) updateMouse(msg tea.MouseMsg) (tea.Model, tea.Cmd) {
+	if m.grep != nil {
+		switch msg.Button {
+		case tea.MouseButtonWheelUp:
+			m.moveGrepCursor(-3)
+		case tea.MouseButtonWheelDown:
+			m.moveGrepCursor(3)
+		}
+		return m, nil
+	}
+
+	// The wheel scrolls whichever pane the pointer is over
+	if treeWidth, previewWidth := m.paneWidths(); previewWidth > 0 && msg.X > treeWidth {
+		switch msg.Button {
+		case tea.MouseButtonWheelUp:
+			m.scrollPreview(-3)
+		case tea.MouseButtonWheelDown:
+			m.scrollPreview(3)
+		}
+		return m, nil
+	}
+
 	switch {
 	case msg.Button == tea.MouseButtonWheelUp:
 		m.moveCursor(-3)
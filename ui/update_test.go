@@ -0,0 +1,115 @@
+//go:build !js
+
+package ui
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/almonk/bontree/config"
+	"github.com/almonk/bontree/tree"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// press feeds keys through Update as the terminal would send them: runs of
+// runes, with each space as its own KeySpace message.
+func press(m Model, keys ...string) Model {
+	for _, key := range keys {
+		var msgs []tea.KeyMsg
+		switch key {
+		case "ctrl+f":
+			msgs = append(msgs, tea.KeyMsg{Type: tea.KeyCtrlF})
+		case "ctrl+g":
+			msgs = append(msgs, tea.KeyMsg{Type: tea.KeyCtrlG})
+		case "esc":
+			msgs = append(msgs, tea.KeyMsg{Type: tea.KeyEsc})
+		default:
+			for i, word := range strings.Split(key, " ") {
+				if i > 0 {
+					msgs = append(msgs, tea.KeyMsg{Type: tea.KeySpace, Runes: []rune{' '}})
+				}
+				if word != "" {
+					msgs = append(msgs, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(word)})
+				}
+			}
+		}
+		for _, msg := range msgs {
+			next, _ := m.Update(msg)
+			m = next.(Model)
+		}
+	}
+	return m
+}
+
+func TestUpdateTypesSpaces(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"main.go", "ui/view.go", "ui/view_test.go", "ui/model.go", "docs/view.md"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tr, err := tree.New(dir, tree.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := tr.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := Model{root: root, tree: tr, rootPath: dir, cfg: config.DefaultConfig(), width: 80, height: 20}
+	m.refreshFlatNodes()
+
+	results := func(m Model) string {
+		var paths []string
+		for _, node := range m.flatNodes {
+			if !node.IsDir {
+				paths = append(paths, filepath.ToSlash(node.Path))
+			}
+		}
+		return strings.Join(paths, " ")
+	}
+
+	// Every word has to match, and operators filter what's left
+	for _, tt := range []struct {
+		keys []string
+		want string
+	}{
+		{[]string{"/", "view go"}, "ui/view.go ui/view_test.go"},
+		{[]string{"/", "view !test ext:go"}, "ui/view.go"},
+		{[]string{"ctrl+f", "ui view"}, "ui/view.go ui/view_test.go"},
+		{[]string{"ctrl+f", "view !ext:go"}, "docs/view.md"},
+	} {
+		got := press(m, tt.keys...)
+		query := tt.keys[len(tt.keys)-1]
+		if got.searchQuery != query {
+			t.Errorf("%q: query = %q", query, got.searchQuery)
+		}
+		if r := results(got); r != tt.want {
+			t.Errorf("%q: results = %s, want %s", query, r, tt.want)
+		}
+		if got = press(got, "esc", "esc"); got.filtered || got.searching {
+			t.Errorf("%q: esc should leave the search", query)
+		}
+	}
+
+	// Content search and the rename prompt take spaces too
+	if got := press(m, "ctrl+g", "func main"); got.grep == nil || got.grep.query != "func main" {
+		t.Error("content search query should be \"func main\"")
+	}
+	m.cursor = len(m.flatNodes) - 1
+	got := press(m, "r")
+	if got.input == nil {
+		t.Fatal("r should open the rename prompt")
+	}
+	got.input.value = ""
+	got = press(got, "new name.go")
+	if got.input.value != "new name.go" {
+		t.Errorf("rename prompt = %q, want %q", got.input.value, "new name.go")
+	}
+}
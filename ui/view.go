@@ -18,6 +18,12 @@ func (m Model) View() string {
 	if m.showHelp {
 		return m.helpView()
 	}
+	if m.output != nil {
+		return m.outputView()
+	}
+	if m.grep != nil {
+		return m.grepView()
+	}
 
 	var b strings.Builder
 
@@ -27,30 +33,39 @@ func (m Model) View() string {
 		end = len(m.flatNodes)
 	}
 
-	contentWidth := max(m.width, 20)
+	treeWidth, previewWidth := m.paneWidths()
+	contentWidth := max(treeWidth, 20)
+
+	var previewLines []string
+	if previewWidth > 0 {
+		previewLines = m.renderPreview(previewWidth, viewH)
+	}
 
-	// Render visible tree lines
-	for i := m.scrollOff; i < end; i++ {
-		if i > m.scrollOff {
+	// Render visible tree lines, with the preview pane alongside if shown
+	for row := 0; row < viewH; row++ {
+		if row > 0 {
 			b.WriteString("\n")
 		}
-		b.WriteString(m.renderNode(m.flatNodes[i], i == m.cursor, contentWidth))
+		var line string
+		if i := m.scrollOff + row; i < end {
+			line = m.renderNode(m.flatNodes[i], i == m.cursor, m.isMarked(i), contentWidth)
+		}
+		if previewLines != nil {
+			line = padRight(line, treeWidth) + previewBorderStyle.Render("│") + previewLines[row]
+		}
+		b.WriteString(line)
 	}
 
-	// Pad remaining lines
-	for i := end - m.scrollOff; i < viewH; i++ {
+	// Search or text input (above status bar)
+	if m.input != nil {
 		b.WriteString("\n")
-	}
-
-	// Search input (above status bar)
-	if m.searching {
+		b.WriteString(m.renderInputLine(m.input.prompt, m.input.value))
+	} else if m.searching {
 		b.WriteString("\n")
-		prompt := "\uf002"
-		searchLine := searchPromptStyle.Render(prompt) + searchInputStyle.Render(m.searchQuery+"█")
-		if sw := lipgloss.Width(searchLine); sw < m.width {
-			searchLine += statusBase.Render(strings.Repeat(" ", m.width-sw))
-		}
-		b.WriteString(searchLine)
+		b.WriteString(m.renderInputLine("\uf002", m.searchQuery))
+	} else if m.copyMenu {
+		b.WriteString("\n")
+		b.WriteString(m.renderCopyMenu())
 	}
 
 	// Status bar
@@ -70,7 +85,10 @@ func (m Model) renderStatusBar() string {
 	// Determine mode label and color
 	var modeLabel string
 	var modeBg lipgloss.TerminalColor
-	if m.filtered || m.searching {
+	if m.grep != nil {
+		modeLabel = "GREP"
+		modeBg = colorRed
+	} else if m.filtered || m.searching {
 		if m.flatSearch {
 			modeLabel = "FFIND"
 			modeBg = colorOrange
@@ -78,6 +96,15 @@ func (m Model) renderStatusBar() string {
 			modeLabel = "FILTER"
 			modeBg = colorPurple
 		}
+	} else if m.visualAnchor != nil {
+		modeLabel = "VISUAL"
+		modeBg = colorGreen
+	} else if m.changedOnly {
+		modeLabel = "CHANGED"
+		modeBg = colorYellow
+	} else if m.pickMode {
+		modeLabel = "PICK"
+		modeBg = colorCyan
 	} else {
 		modeLabel = "NORMAL"
 		modeBg = colorBlue
@@ -94,11 +121,33 @@ func (m Model) renderStatusBar() string {
 	var right string
 	if w >= 60 {
 		right = statusHelpStyle.Render(" ?:help  c:copy  q:quit ")
+		if m.pickMode {
+			right = statusHelpStyle.Render(" ?:help  enter:pick  q:cancel ")
+		}
+		if m.grep != nil {
+			right = statusHelpStyle.Render(" enter:open  esc:close ")
+		}
+	}
+	if m.grep != nil && m.grep.summary() != "" {
+		right = statusHelpStyle.Render(" "+m.grep.summary()+" ") + right
+	}
+	if m.changedOnly {
+		right = m.renderChangeCounts() + right
+	}
+	if len(m.marks) > 0 {
+		right = statusMarkStyle.Render(fmt.Sprintf(" %d marked ", len(m.marks))) + right
+	}
+	if m.pasting != nil {
+		right = statusMarkStyle.Render(" "+m.pasting.label()+" ") + right
 	}
 
 	var left string
 
-	if m.flashMsg != "" {
+	if m.confirm != nil {
+		left = modeStyle.Render(" "+modeLabel+" ") +
+			lipgloss.NewStyle().Foreground(modeBg).Background(colorBg).Render(chevron) +
+			statusConfirmStyle.Render(" "+m.confirm.msg)
+	} else if m.flashMsg != "" {
 		left = modeStyle.Render(" "+modeLabel+" ") +
 			lipgloss.NewStyle().Foreground(modeBg).Background(colorBg).Render(chevron) +
 			statusFlashStyle.Render(" "+m.flashMsg)
@@ -117,6 +166,9 @@ func (m Model) renderStatusBar() string {
 				branch, _ = middleTruncate(branch, branchMax, nil)
 			}
 			branchText = fmt.Sprintf(" \ue725 %s ", branch)
+			if m.baseRef != "" {
+				branchText = fmt.Sprintf(" \ue725 %s vs %s ", branch, m.baseRef)
+			}
 		}
 		branchBg := lipgloss.AdaptiveColor{Light: "252", Dark: "237"}
 
@@ -147,7 +199,7 @@ func (m Model) renderStatusBar() string {
 	return left + statusBase.Render(strings.Repeat(" ", padding)) + right
 }
 
-func (m Model) renderNode(node *tree.Node, selected bool, maxWidth int) string {
+func (m Model) renderNode(node *tree.Node, selected, marked bool, maxWidth int) string {
 	var prefix string
 	if !m.flatSearch {
 		prefix = m.getDisplayPrefix(node, node.Depth)
@@ -161,11 +213,30 @@ func (m Model) renderNode(node *tree.Node, selected bool, maxWidth int) string {
 		dirPath = strings.TrimPrefix(node.Parent.Path, "./")
 	}
 
+	// Line counts and the two-column staged/unstaged glyph, right-aligned
+	status := m.gitStatusOf(node)
+	var glyphWidth int
+	if hasStatusGlyph(status) {
+		glyphWidth = 3 // two columns + trailing space
+	}
+
 	// Calculate available width for name (+ dirPath) and truncate if needed
-	// Layout: " " + prefix + icon + " " + name [+ "  " + dirPath]
+	// Layout: " " + prefix + icon + " " + name [+ "  " + dirPath] [+ pad + counts + " " + glyph + " "]
 	prefixWidth := lipgloss.Width(prefix)
 	iconWidth := lipgloss.Width(icon)
-	fixedWidth := 1 + prefixWidth + iconWidth + 1
+	fixedWidth := 1 + prefixWidth + iconWidth + 1 + glyphWidth
+
+	// Counts are dropped first when the row is too narrow for them
+	var counts lineCount
+	if glyphWidth > 0 {
+		counts = m.lineCountOf(node)
+		if w := lineCountWidth(counts); w > 0 && maxWidth-fixedWidth-w-1 >= minNameWidth {
+			glyphWidth += w + 1
+			fixedWidth += w + 1
+		} else {
+			counts = lineCount{}
+		}
+	}
 	available := maxWidth - fixedWidth
 	if available < 4 {
 		available = 4
@@ -205,7 +276,11 @@ func (m Model) renderNode(node *tree.Node, selected bool, maxWidth int) string {
 	if selected {
 		treeLineSelectedStyle := lipgloss.NewStyle().Foreground(colorFgDim).Background(colorSelection)
 		var parts []string
-		parts = append(parts, selectedStyle.Render(" "))
+		if marked {
+			parts = append(parts, markStyle.Background(colorSelection).Render(markGlyph))
+		} else {
+			parts = append(parts, selectedStyle.Render(" "))
+		}
 		if prefix != "" {
 			parts = append(parts, treeLineSelectedStyle.Render(prefix))
 		}
@@ -224,8 +299,14 @@ func (m Model) renderNode(node *tree.Node, selected bool, maxWidth int) string {
 			parts = append(parts, m.renderNameHighlighted(displayDirPath, pathIndices, flatPathSelectedStyle, matchHighlightSelectedStyle))
 		}
 
-		if plainLen := lipgloss.Width(strings.Join(parts, "")); plainLen < maxWidth {
-			parts = append(parts, selectedStyle.Render(strings.Repeat(" ", maxWidth-plainLen)))
+		if plainLen := lipgloss.Width(strings.Join(parts, "")); plainLen < maxWidth-glyphWidth {
+			parts = append(parts, selectedStyle.Render(strings.Repeat(" ", maxWidth-glyphWidth-plainLen)))
+		}
+		if glyphWidth > 0 {
+			if counts != (lineCount{}) {
+				parts = append(parts, renderLineCount(counts, colorSelection), selectedStyle.Render(" "))
+			}
+			parts = append(parts, renderStatusGlyph(status, colorSelection), selectedStyle.Render(" "))
 		}
 
 		// Strip intermediate RESETs so the selection background is continuous.
@@ -239,7 +320,11 @@ func (m Model) renderNode(node *tree.Node, selected bool, maxWidth int) string {
 	}
 
 	var parts []string
-	parts = append(parts, " ")
+	if marked {
+		parts = append(parts, markStyle.Render(markGlyph))
+	} else {
+		parts = append(parts, " ")
+	}
 	if prefix != "" {
 		parts = append(parts, treeLineStyle.Render(prefix))
 	}
@@ -261,25 +346,107 @@ func (m Model) renderNode(node *tree.Node, selected bool, maxWidth int) string {
 		parts = append(parts, dirRendered)
 	}
 
+	if glyphWidth > 0 {
+		if plainLen := lipgloss.Width(strings.Join(parts, "")); plainLen < maxWidth-glyphWidth {
+			parts = append(parts, strings.Repeat(" ", maxWidth-glyphWidth-plainLen))
+		}
+		if counts != (lineCount{}) {
+			parts = append(parts, renderLineCount(counts, nil), " ")
+		}
+		parts = append(parts, renderStatusGlyph(status, nil), " ")
+	}
+
 	return strings.Join(parts, "")
 }
 
+// minNameWidth is the narrowest name column worth keeping before line
+// counts are hidden to make room.
+const minNameWidth = 12
+
+// formatLineCount renders counts as e.g. "+12 −3", leaving out zero sides.
+func formatLineCount(c lineCount) (added, removed string) {
+	if c.added > 0 {
+		added = fmt.Sprintf("+%d", c.added)
+	}
+	if c.removed > 0 {
+		removed = fmt.Sprintf("−%d", c.removed)
+	}
+	return added, removed
+}
+
+// lineCountWidth returns the cells renderLineCount needs, or 0 if there is
+// nothing to show.
+func lineCountWidth(c lineCount) int {
+	added, removed := formatLineCount(c)
+	if added != "" && removed != "" {
+		return lipgloss.Width(added) + 1 + lipgloss.Width(removed)
+	}
+	return lipgloss.Width(added + removed)
+}
+
+// renderLineCount renders the added count in green and the removed count
+// in red. bg is the row background, or nil for none.
+func renderLineCount(c lineCount, bg lipgloss.TerminalColor) string {
+	addedStyle, removedStyle := diffAddedStyle, diffRemovedStyle
+	if bg != nil {
+		addedStyle = addedStyle.Background(bg)
+		removedStyle = removedStyle.Background(bg)
+	}
+	added, removed := formatLineCount(c)
+	switch {
+	case added != "" && removed != "":
+		return addedStyle.Render(added) + addedStyle.Render(" ") + removedStyle.Render(removed)
+	case added != "":
+		return addedStyle.Render(added)
+	}
+	return removedStyle.Render(removed)
+}
+
+// hasStatusGlyph reports whether a row shows a staged/unstaged glyph.
+// Ignored files are already dimmed, so they don't get one.
+func hasStatusGlyph(status gitFileStatus) bool {
+	s := status.summary()
+	return s != gitUnchanged && s != gitIgnored
+}
+
+// renderStatusGlyph renders the porcelain-style XY glyph: the staged
+// (index) column in green and the unstaged (worktree) column in red.
+// Files that only differ from the base ref by commits get a purple letter.
+// bg is the row background, or nil for none.
+func renderStatusGlyph(status gitFileStatus, bg lipgloss.TerminalColor) string {
+	staged := gitStagedStyle
+	unstaged := gitUnstagedStyle
+	if bg != nil {
+		staged = staged.Background(bg)
+		unstaged = unstaged.Background(bg)
+	}
+	if status.committed() {
+		// Changed since the base ref, but already committed
+		committed := gitCommittedStyle
+		if bg != nil {
+			committed = committed.Background(bg)
+		}
+		return committed.Render(status.base.letter()) + unstaged.Render(" ")
+	}
+	index := staged.Render(status.index.letter())
+	if status.index == gitUnchanged && status.worktree == gitUntracked {
+		// Nothing is staged, but git still shows untracked files as ??
+		index = unstaged.Render(status.worktree.letter())
+	}
+	return index + unstaged.Render(status.worktree.letter())
+}
+
 // gitNodeStyles returns the icon and name styles for a node based on its git status.
 func (m Model) gitNodeStyles(node *tree.Node) (lipgloss.Style, lipgloss.Style) {
-	if m.gitFiles != nil {
-		relPath := strings.TrimPrefix(node.Path, "./")
-		if status, ok := m.gitFiles[relPath]; ok {
-			switch status {
-			case gitModified:
-				return lipgloss.NewStyle().Foreground(colorBlue), lipgloss.NewStyle().Foreground(colorBlue)
-			case gitAdded, gitUntracked:
-				return lipgloss.NewStyle().Foreground(colorGreen), lipgloss.NewStyle().Foreground(colorGreen)
-			case gitDeleted:
-				return lipgloss.NewStyle().Foreground(colorRed), lipgloss.NewStyle().Foreground(colorRed)
-			case gitIgnored:
-				return lipgloss.NewStyle().Foreground(colorGutter), lipgloss.NewStyle().Foreground(colorGutter)
-			}
-		}
+	switch m.gitStatusOf(node).summary() {
+	case gitModified:
+		return lipgloss.NewStyle().Foreground(colorBlue), lipgloss.NewStyle().Foreground(colorBlue)
+	case gitAdded, gitUntracked:
+		return lipgloss.NewStyle().Foreground(colorGreen), lipgloss.NewStyle().Foreground(colorGreen)
+	case gitDeleted:
+		return lipgloss.NewStyle().Foreground(colorRed), lipgloss.NewStyle().Foreground(colorRed)
+	case gitIgnored:
+		return lipgloss.NewStyle().Foreground(colorGutter), lipgloss.NewStyle().Foreground(colorGutter)
 	}
 	// Default styles
 	if node.IsDir {
@@ -444,12 +611,37 @@ func (m Model) helpView() string {
 		{config.ActionCollapse, "Collapse directory / go to parent"},
 		{config.ActionToggle, "Toggle directory open/close"},
 		{config.ActionCopyPath, "Copy relative path to clipboard"},
+		{config.ActionCopyMenu, "Copy as… (mention, link, contents, …)"},
 		{config.ActionOpenEditor, "Open file in $EDITOR"},
+		{config.ActionToggleMark, "Mark / unmark and move down"},
+		{config.ActionVisualMark, "Mark a range (visual selection)"},
+		{config.ActionMarkAll, "Mark all matches / changed files"},
+		{config.ActionClearMarks, "Clear marks"},
+		{config.ActionGitStage, "Stage file / directory (git add)"},
+		{config.ActionGitUnstage, "Unstage file / directory"},
+		{config.ActionGitDiscard, "Discard unstaged changes"},
+		{config.ActionNewFile, "New file (a trailing / makes a directory)"},
+		{config.ActionNewDir, "New directory"},
+		{config.ActionRename, "Rename"},
+		{config.ActionMove, "Move to another directory"},
+		{config.ActionTrash, "Move to the trash"},
+		{config.ActionYank, "Yank (copy) file / marked files"},
+		{config.ActionCut, "Cut file / marked files"},
+		{config.ActionPaste, "Paste into the cursor directory"},
+		{config.ActionUndo, "Undo the last file change or discard"},
+		{config.ActionRedo, "Redo"},
 		{config.ActionExpandAll, "Expand all"},
 		{config.ActionCollapseAll, "Collapse all"},
 		{config.ActionSearch, "Fuzzy search (tree)"},
 		{config.ActionFlatSearch, "Flat file search"},
+		{config.ActionGrep, "Search file contents (grep)"},
 		{config.ActionToggleHidden, "Toggle hidden files"},
+		{config.ActionToggleChanged, "Show changed files only"},
+		{config.ActionSetBase, "Compare against a base ref"},
+		{config.ActionTogglePreview, "Toggle file preview"},
+		{config.ActionToggleDiff, "Toggle diff / contents in preview"},
+		{config.ActionPreviewDown, "Scroll preview down"},
+		{config.ActionPreviewUp, "Scroll preview up"},
 		{config.ActionClearFilter, "Clear filter"},
 		{config.ActionHelp, "Toggle help"},
 		{config.ActionQuit, "Quit"},
@@ -465,6 +657,13 @@ func (m Model) helpView() string {
 	descStyle := lipgloss.NewStyle().
 		Foreground(colorFgDim)
 
+	for _, cmd := range m.cfg.Commands {
+		actionOrder = append(actionOrder, struct {
+			action config.Action
+			desc   string
+		}{config.CommandAction(cmd.Name), "Run " + cmd.Name})
+	}
+
 	for _, entry := range actionOrder {
 		keys := m.cfg.KeysFor(entry.action)
 		if len(keys) == 0 {
@@ -0,0 +1,211 @@
+//go:build !js
+
+package ui
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/almonk/bontree/tree"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	// fsQuietPeriod is how long the watcher waits for a burst of events to
+	// settle before reporting it.
+	fsQuietPeriod = 75 * time.Millisecond
+	// fsMaxDelay caps how long a continuous stream of events can postpone
+	// a refresh, so a busy agent still produces visible updates.
+	fsMaxDelay = 500 * time.Millisecond
+)
+
+// fsChangedMsg reports a coalesced batch of filesystem events.
+type fsChangedMsg struct {
+	dirs map[string]bool // relative paths of directories whose entries changed
+	git  bool            // git status may have changed
+}
+
+// fsWatcher watches the loaded directories of the tree plus the repository's
+// .git directory, so the UI only refreshes when something actually changed.
+type fsWatcher struct {
+	w       *fsnotify.Watcher
+	absRoot string
+	gitDir  string
+	watched map[string]bool // absolute paths currently subscribed
+
+	// The root and Tree.Loads value of the last sync, so messages that
+	// load nothing don't walk the tree.
+	syncedRoot  *tree.Node
+	syncedLoads uint64
+}
+
+// newFSWatcher creates a watcher for the tree rooted at rootPath. It returns
+// nil when the platform watcher is unavailable; callers fall back to polling.
+func newFSWatcher(rootPath string) *fsWatcher {
+	absRoot, err := filepath.Abs(rootPath)
+	if err != nil {
+		return nil
+	}
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil
+	}
+	fw := &fsWatcher{
+		w:       w,
+		absRoot: absRoot,
+		watched: make(map[string]bool),
+	}
+	// Index and HEAD live directly in the git dir, so a non-recursive
+	// watch catches staging, commits and branch switches.
+	if gitDir := findGitDir(absRoot); gitDir != "" {
+		if err := w.Add(gitDir); err == nil {
+			fw.gitDir = gitDir
+		}
+	}
+	return fw
+}
+
+// findGitDir returns the git directory of the repository containing
+// absRoot, or "" outside one. It isn't always absRoot/.git: bontree may be
+// opened on a subdirectory, and in a linked worktree .git is a file
+// pointing elsewhere.
+func findGitDir(absRoot string) string {
+	out, err := exec.Command("git", "-C", absRoot, "rev-parse", "--absolute-git-dir").Output()
+	if err == nil {
+		return strings.TrimSpace(string(out))
+	}
+	// No git binary (or a very old one): fall back to the usual layout
+	if top := tree.FindRepoRoot(absRoot); top != "" {
+		if info, err := os.Stat(filepath.Join(top, ".git")); err == nil && info.IsDir() {
+			return filepath.Join(top, ".git")
+		}
+	}
+	return ""
+}
+
+// sync subscribes to every loaded directory under root and drops watches
+// for directories that are no longer part of the tree. loads is the tree's
+// Loads value; nothing is done while it and root stay the same.
+func (fw *fsWatcher) sync(root *tree.Node, loads uint64) {
+	if fw == nil || root == nil {
+		return
+	}
+	if root == fw.syncedRoot && loads == fw.syncedLoads {
+		return
+	}
+	fw.syncedRoot, fw.syncedLoads = root, loads
+	want := make(map[string]bool)
+	for _, dir := range tree.LoadedDirs(root) {
+		want[dir.AbsPath] = true
+	}
+	for path := range fw.watched {
+		if !want[path] {
+			fw.w.Remove(path)
+			delete(fw.watched, path)
+		}
+	}
+	for path := range want {
+		if !fw.watched[path] {
+			if err := fw.w.Add(path); err == nil {
+				fw.watched[path] = true
+			}
+		}
+	}
+}
+
+// wait blocks until the next burst of filesystem events has settled and
+// reports it as a single fsChangedMsg.
+func (fw *fsWatcher) wait() tea.Cmd {
+	return func() tea.Msg {
+		msg := fsChangedMsg{dirs: make(map[string]bool)}
+		var deadline <-chan time.Time
+		var quiet <-chan time.Time
+		for {
+			select {
+			case ev, ok := <-fw.w.Events:
+				if !ok {
+					return nil
+				}
+				if !fw.record(ev, &msg) {
+					continue
+				}
+				if deadline == nil {
+					deadline = time.After(fsMaxDelay)
+				}
+				quiet = time.After(fsQuietPeriod)
+			case _, ok := <-fw.w.Errors:
+				if !ok {
+					return nil
+				}
+			case <-quiet:
+				return msg
+			case <-deadline:
+				return msg
+			}
+		}
+	}
+}
+
+// record folds a single event into msg. It reports whether the event was
+// relevant at all.
+func (fw *fsWatcher) record(ev fsnotify.Event, msg *fsChangedMsg) bool {
+	if ev.Op == fsnotify.Chmod {
+		return false
+	}
+	dir := filepath.Dir(ev.Name)
+	if fw.gitDir != "" && dir == fw.gitDir {
+		switch filepath.Base(ev.Name) {
+		case "index", "HEAD":
+			msg.git = true
+			return true
+		}
+		return false
+	}
+	rel, err := filepath.Rel(fw.absRoot, dir)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	// Plain writes don't change directory entries, only git status.
+	if ev.Op != fsnotify.Write {
+		msg.dirs[filepath.ToSlash(rel)] = true
+	}
+	msg.git = true
+	return true
+}
+
+// applyFSChanges reloads the directories reported by the watcher, keeping
+// the cursor on the same path.
+func (m *Model) applyFSChanges(dirs map[string]bool) {
+	changed := false
+	for rel := range dirs {
+		node := m.root.Find(rel)
+		if node == nil || !node.IsDir || !node.Loaded {
+			continue
+		}
+		if err := node.Reload(); err == nil {
+			changed = true
+		}
+	}
+	if changed {
+		m.pruneMarks()
+		if !m.searching {
+			m.refreshFlatNodesKeepCursor()
+		}
+	}
+}
+
+// reloadLoadedDirs re-reads every loaded directory, e.g. after the set of
+// gitignored paths changed.
+func (m *Model) reloadLoadedDirs() {
+	for _, dir := range tree.LoadedDirs(m.root) {
+		dir.Reload()
+	}
+	m.pruneMarks()
+	if !m.searching {
+		m.refreshFlatNodesKeepCursor()
+	}
+}
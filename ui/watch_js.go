@@ -0,0 +1,8 @@
+//go:build js
+
+package ui
+
+// fsWatcher is unavailable in the browser demo, which has no filesystem.
+type fsWatcher struct{}
+
+func newFSWatcher(string) *fsWatcher { return nil }